@@ -0,0 +1,57 @@
+package http3
+
+import (
+	"net/http"
+
+	khttp "github.com/go-kratos/kratos/v3/transport/http"
+)
+
+type (
+	// CallOption configures a Call before it starts or extracts information from
+	// a Call after it completes.
+	CallOption = khttp.CallOption
+
+	// EmptyCallOption does not alter the Call configuration.
+	EmptyCallOption = khttp.EmptyCallOption
+
+	// ContentTypeCallOption is BodyCallOption
+	ContentTypeCallOption = khttp.ContentTypeCallOption
+
+	// AcceptCallOption sets the accepted response content type.
+	AcceptCallOption = khttp.AcceptCallOption
+
+	// OperationCallOption is set ServiceMethod for client call
+	OperationCallOption = khttp.OperationCallOption
+
+	// PathTemplateCallOption is set path template for client call
+	PathTemplateCallOption = khttp.PathTemplateCallOption
+
+	// HeaderCallOption is retrieve response header for client call
+	HeaderCallOption = khttp.HeaderCallOption
+)
+
+// ContentType with request content type.
+func ContentType(contentType string) CallOption {
+	return khttp.ContentType(contentType)
+}
+
+// Accept sets the request Accept header.
+func Accept(contentType string) CallOption {
+	return khttp.Accept(contentType)
+}
+
+// Operation is serviceMethod call option
+func Operation(operation string) CallOption {
+	return khttp.Operation(operation)
+}
+
+// PathTemplate is http path template
+func PathTemplate(pattern string) CallOption {
+	return khttp.PathTemplate(pattern)
+}
+
+// Header returns a CallOptions that retrieves the http response header
+// from server reply.
+func Header(header *http.Header) CallOption {
+	return khttp.Header(header)
+}
@@ -0,0 +1,221 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/registry"
+	"github.com/go-kratos/kratos/v3/selector"
+	"github.com/go-kratos/kratos/v3/selector/wrr"
+	"github.com/go-kratos/kratos/v3/transport"
+	khttp "github.com/go-kratos/kratos/v3/transport/http"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func init() {
+	if selector.GlobalSelector() == nil {
+		selector.SetGlobalSelector(wrr.NewBuilder())
+	}
+}
+
+type (
+	// DecodeErrorFunc is decode error func.
+	DecodeErrorFunc = khttp.DecodeErrorFunc
+
+	// EncodeRequestFunc is request encode func.
+	EncodeRequestFunc = khttp.EncodeRequestFunc
+
+	// DecodeResponseFunc is response decode func.
+	DecodeResponseFunc = khttp.DecodeResponseFunc
+)
+
+// ClientOption is HTTP3 client option.
+type ClientOption func(*clientOptions)
+
+// clientOptions holds the HTTP/3 settings, the others are kratos HTTP client options.
+type clientOptions struct {
+	tlsConf    *tls.Config
+	quicConf   *quic.Config
+	transport  http.RoundTripper
+	middleware []middleware.Middleware
+	opts       []khttp.ClientOption
+}
+
+// WithTransport with client transport, replaces the default http3.Transport.
+func WithTransport(trans http.RoundTripper) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = trans
+	}
+}
+
+// WithTimeout with client request timeout.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithTimeout(d))
+	}
+}
+
+// WithUserAgent with client user agent.
+func WithUserAgent(ua string) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithUserAgent(ua))
+	}
+}
+
+// WithMiddleware with client middleware.
+func WithMiddleware(m ...middleware.Middleware) ClientOption {
+	return func(o *clientOptions) {
+		o.middleware = m
+	}
+}
+
+// WithEndpoint with client addr.
+func WithEndpoint(endpoint string) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithEndpoint(endpoint))
+	}
+}
+
+// WithRequestEncoder with client request encoder.
+func WithRequestEncoder(encoder EncodeRequestFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithRequestEncoder(encoder))
+	}
+}
+
+// WithResponseDecoder with client response decoder.
+func WithResponseDecoder(decoder DecodeResponseFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithResponseDecoder(decoder))
+	}
+}
+
+// WithErrorDecoder with client error decoder.
+func WithErrorDecoder(errorDecoder DecodeErrorFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithErrorDecoder(errorDecoder))
+	}
+}
+
+// WithDiscovery with client discovery.
+func WithDiscovery(d registry.Discovery) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithDiscovery(d))
+	}
+}
+
+// WithNodeFilter with select filters
+func WithNodeFilter(filters ...selector.NodeFilter) ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithNodeFilter(filters...))
+	}
+}
+
+// WithBlock with client block.
+func WithBlock() ClientOption {
+	return func(o *clientOptions) {
+		o.opts = append(o.opts, khttp.WithBlock())
+	}
+}
+
+// WithTLSConfig with tls config.
+func WithTLSConfig(c *tls.Config) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConf = c
+	}
+}
+
+// WithQUICConfig with quic config.
+func WithQUICConfig(c *quic.Config) ClientOption {
+	return func(o *clientOptions) {
+		o.quicConf = c
+	}
+}
+
+// Client is a kratos HTTP client sending its requests over HTTP/3, generated
+// *_http.pb.go clients take the embedded *khttp.Client as is.
+type Client struct {
+	*khttp.Client
+	h3 *http3.Transport
+}
+
+// NewClient returns an HTTP3 client.
+func NewClient(ctx context.Context, opts ...ClientOption) (*Client, error) {
+	options := clientOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+	// the kratos client sends https requests once it has a TLS config
+	if options.tlsConf == nil {
+		options.tlsConf = &tls.Config{}
+	}
+	var h3 *http3.Transport
+	if options.transport == nil {
+		h3 = &http3.Transport{
+			TLSClientConfig: options.tlsConf,
+			QUICConfig:      options.quicConf,
+		}
+		options.transport = h3
+	}
+	cli, err := khttp.NewClient(ctx, append(options.opts,
+		khttp.WithTLSConfig(options.tlsConf),
+		khttp.WithTransport(&roundTripper{RoundTripper: options.transport}),
+		khttp.WithMiddleware(append([]middleware.Middleware{clientTransport}, options.middleware...)...),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: cli, h3: h3}, nil
+}
+
+// clientTransport replaces the Transport of the kratos HTTP client in the call
+// context with one of kind KindHTTP3, so that the middleware tells them apart.
+func clientTransport(handler middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req any) (any, error) {
+		if tr, ok := transport.FromClientContext(ctx); ok {
+			if ht, ok := tr.(khttp.Transporter); ok {
+				ctx = transport.NewClientContext(ctx, &Transport{
+					endpoint:     ht.Endpoint(),
+					operation:    ht.Operation(),
+					reqHeader:    headerCarrier(ht.Request().Header),
+					request:      ht.Request(),
+					pathTemplate: ht.PathTemplate(),
+				})
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// roundTripper records the reply header in the client Transport of the call.
+type roundTripper struct {
+	http.RoundTripper
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := rt.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if tr, ok := transport.FromClientContext(req.Context()); ok {
+		if ht, ok := tr.(*Transport); ok {
+			ht.replyHeader = headerCarrier(res.Header)
+		}
+	}
+	return res, nil
+}
+
+// Close tears down the Transport and all underlying connections.
+func (client *Client) Close() error {
+	err := client.Client.Close()
+	if client.h3 != nil {
+		if closeErr := client.h3.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package http3
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/blink-io/kratos-transport/testing/tlsutil"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/registry"
+	"github.com/go-kratos/kratos/v3/transport"
+	khttp "github.com/go-kratos/kratos/v3/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDiscovery struct {
+	services []*registry.ServiceInstance
+}
+
+func (d *mockDiscovery) GetService(_ context.Context, _ string) ([]*registry.ServiceInstance, error) {
+	return d.services, nil
+}
+
+func (d *mockDiscovery) Watch(ctx context.Context, _ string) (registry.Watcher, error) {
+	return &mockWatcher{ctx: ctx, services: d.services}, nil
+}
+
+type mockWatcher struct {
+	ctx      context.Context
+	services []*registry.ServiceInstance
+	sent     bool
+}
+
+func (w *mockWatcher) Next() ([]*registry.ServiceInstance, error) {
+	if !w.sent {
+		w.sent = true
+		return w.services, nil
+	}
+	<-w.ctx.Done()
+	return nil, w.ctx.Err()
+}
+
+func (w *mockWatcher) Stop() error { return nil }
+
+type helloReply struct {
+	Message string `json:"message"`
+}
+
+func startTestServer(t *testing.T) *url.URL {
+	srv := NewServer(
+		Address("127.0.0.1:0"),
+		TLSConfig(tlsutil.GenerateTLSConfig()),
+	)
+	srv.Route("/").GET("/hello/{name}", func(ctx Context) error {
+		return ctx.Result(http.StatusOK, &helloReply{Message: "hello " + ctx.Vars().Get("name")})
+	})
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = srv.Start(context.Background())
+	}()
+	time.Sleep(100 * time.Millisecond)
+	t.Cleanup(func() {
+		_ = srv.Stop(context.Background())
+	})
+	return endpoint
+}
+
+func TestClient_Invoke(t *testing.T) {
+	endpoint := startTestServer(t)
+
+	var kind transport.Kind
+	var operation, replyType string
+	cli, err := NewClient(context.Background(),
+		WithEndpoint(endpoint.Host),
+		WithTLSConfig(tlsutil.MustInsecureTLSConfig()),
+		WithMiddleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				tr, ok := transport.FromClientContext(ctx)
+				if ok {
+					kind = tr.Kind()
+					operation = tr.Operation()
+				}
+				reply, err := handler(ctx, req)
+				if ok {
+					replyType = tr.ReplyHeader().Get("Content-Type")
+				}
+				return reply, err
+			}
+		}),
+	)
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	var header http.Header
+	var reply helloReply
+	err = cli.Invoke(context.Background(), http.MethodGet, "/hello/kratos", nil, &reply,
+		Operation("/hello.Greeter/SayHello"),
+		Header(&header),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello kratos", reply.Message)
+	assert.Equal(t, KindHTTP3, kind)
+	assert.Equal(t, "/hello.Greeter/SayHello", operation)
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "application/json", replyType)
+
+	// generated clients take the embedded kratos HTTP client
+	err = cli.Client.Invoke(context.Background(), http.MethodGet, "/hello/generated", nil, &reply, khttp.Operation("/hello.Greeter/SayHello"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello generated", reply.Message)
+	assert.Equal(t, KindHTTP3, kind)
+}
+
+func TestClient_Discovery(t *testing.T) {
+	endpoint := startTestServer(t)
+
+	d := &mockDiscovery{services: []*registry.ServiceInstance{{
+		ID:        "1",
+		Name:      "hello",
+		Endpoints: []string{"tcp://127.0.0.1:9000", endpoint.String()},
+	}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli, err := NewClient(ctx,
+		WithEndpoint("discovery:///hello"),
+		WithDiscovery(d),
+		WithBlock(),
+		WithTLSConfig(tlsutil.MustInsecureTLSConfig()),
+	)
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	var reply helloReply
+	err = cli.Invoke(context.Background(), http.MethodGet, "/hello/discovery", nil, &reply)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello discovery", reply.Message)
+}
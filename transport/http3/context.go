@@ -43,6 +43,20 @@ type Context = khttp.Context
 //	Reset(http.ResponseWriter, *http.Request)
 //}
 
+type middlewareAppliedKey struct{}
+
+// withMiddlewareApplied marks the context as already wrapped by the server
+// middleware chain matched for operation, so Context.Middleware does not run
+// it a second time.
+func withMiddlewareApplied(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, middlewareAppliedKey{}, operation)
+}
+
+func middlewareApplied(ctx context.Context) (string, bool) {
+	operation, ok := ctx.Value(middlewareAppliedKey{}).(string)
+	return operation, ok
+}
+
 type responseWriter struct {
 	code int
 	w    http.ResponseWriter
@@ -94,10 +108,20 @@ func (c *wrapper) Query() url.Values {
 func (c *wrapper) Request() *http.Request        { return c.req }
 func (c *wrapper) Response() http.ResponseWriter { return c.res }
 func (c *wrapper) Middleware(h middleware.Handler) middleware.Handler {
-	if tr, ok := transport.FromServerContext(c.req.Context()); ok {
-		return middleware.Chain(c.router.srv.middleware.Match(tr.Operation())...)(h)
+	tr, ok := transport.FromServerContext(c.req.Context())
+	if !ok {
+		return middleware.Chain(c.router.srv.middleware.Match(c.req.URL.Path)...)(h)
+	}
+	ms := c.router.srv.middleware.Match(tr.Operation())
+	if applied, ok := middlewareApplied(c.req.Context()); ok {
+		if tr.Operation() == applied {
+			return h
+		}
+		// the handler set its own operation: the global middleware already
+		// ran in the filter, the middleware selected by the operation did not
+		ms = ms[c.router.srv.globalMw:]
 	}
-	return middleware.Chain(c.router.srv.middleware.Match(c.req.URL.Path)...)(h)
+	return middleware.Chain(ms...)(h)
 }
 func (c *wrapper) Bind(v any) error      { return c.router.srv.decBody(c.req, v) }
 func (c *wrapper) BindVars(v any) error  { return c.router.srv.decVars(c.req, v) }
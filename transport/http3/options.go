@@ -2,19 +2,45 @@ package http3
 
 import (
 	"crypto/tls"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/go-kratos/kratos/v3/middleware"
 	khttp "github.com/go-kratos/kratos/v3/transport/http"
+	"github.com/quic-go/quic-go/http3"
 )
 
 // ServerOption is an HTTP server option.
 type ServerOption func(*Server)
 
+// Address with server address.
 func Address(addr string) ServerOption {
 	return func(s *Server) {
-		s.Addr = addr
+		s.address = addr
+	}
+}
+
+// Listener with an existing UDP connection to serve HTTP/3 on.
+func Listener(conn net.PacketConn) ServerOption {
+	return func(s *Server) {
+		s.conn = conn
+	}
+}
+
+// QUICListener with an existing QUIC listener, which must be configured with
+// http3.ConfigureTLSConfig.
+func QUICListener(lis http3.QUICListener) ServerOption {
+	return func(s *Server) {
+		s.quicLis = lis
+	}
+}
+
+// Endpoint with server endpoint, overriding the one resolved from the listener.
+func Endpoint(endpoint *url.URL) ServerOption {
+	return func(s *Server) {
+		s.endpoint = endpoint
 	}
 }
 
@@ -29,6 +55,24 @@ func Timeout(timeout time.Duration) ServerOption {
 func Middleware(m ...middleware.Middleware) ServerOption {
 	return func(o *Server) {
 		o.middleware.Use(m...)
+		o.globalMw = len(m)
+	}
+}
+
+// HandlerMiddleware applies the matched service middleware to every routed
+// request, so plain handlers registered with Handle, HandleFunc or HandlePrefix
+// run through the same chain as generated ones.
+func HandlerMiddleware(enabled bool) ServerOption {
+	return func(o *Server) {
+		o.handlerMw = enabled
+	}
+}
+
+// DualStack additionally serves HTTP/1.1 and HTTP/2 over TLS/TCP on the same
+// address, advertising HTTP/3 to those clients through the Alt-Svc header.
+func DualStack(enabled bool) ServerOption {
+	return func(o *Server) {
+		o.dualStack = enabled
 	}
 }
 
@@ -4,12 +4,16 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/blink-io/kratos-transport/transport/http3/matcher"
+	"github.com/blink-io/kratos-transport/utils"
 	klog "github.com/go-kratos/kratos/v3/log"
 	"github.com/go-kratos/kratos/v3/middleware"
 	"github.com/go-kratos/kratos/v3/transport"
@@ -31,6 +35,11 @@ var (
 
 type Server struct {
 	*http3.Server
+	tcpServer   *http.Server
+	conn        net.PacketConn
+	quicLis     http3.QUICListener
+	tcpLis      net.Listener
+	address     string
 	tlsConf     *tls.Config
 	endpoint    *url.URL
 	err         error
@@ -44,10 +53,14 @@ type Server struct {
 	ene         khttp.EncodeErrorFunc
 	router      *mux.Router
 	strictSlash bool
+	handlerMw   bool
+	globalMw    int
+	dualStack   bool
 }
 
 func NewServer(opts ...ServerOption) *Server {
 	srv := &Server{
+		address:     ":8443",
 		timeout:     1 * time.Second,
 		middleware:  matcher.New(),
 		decVars:     khttp.DefaultRequestVars,
@@ -67,7 +80,7 @@ func NewServer(opts ...ServerOption) *Server {
 	srv.router.StrictSlash(srv.strictSlash)
 	srv.router.Use(srv.filter())
 	srv.Server = &http3.Server{
-		Addr:   ":8443",
+		Addr:   srv.address,
 		Logger: klog.Default(),
 		ConnContext: func(ctx context.Context, c *quic.Conn) context.Context {
 			return ctx
@@ -75,8 +88,14 @@ func NewServer(opts ...ServerOption) *Server {
 		Handler:   khttp.FilterChain(srv.filters...)(srv.router),
 		TLSConfig: srv.tlsConf,
 	}
-
-	_, _ = srv.Endpoint()
+	if srv.dualStack {
+		srv.tcpServer = &http.Server{
+			Addr:      srv.address,
+			Handler:   http.HandlerFunc(srv.serveTCP),
+			TLSConfig: srv.tlsConf.Clone(),
+			ErrorLog:  slog.NewLogLogger(klog.Default().Handler(), slog.LevelError),
+		}
+	}
 
 	return srv
 }
@@ -90,31 +109,105 @@ func (s *Server) Use(selector string, m ...middleware.Middleware) {
 	s.middleware.Add(selector, m...)
 }
 
+// Endpoint returns the dialable server address, binding the listener first
+// so that a ":0" address reports the real port.
 func (s *Server) Endpoint() (*url.URL, error) {
-	addr := s.Addr
+	if err := s.listenAndEndpoint(); err != nil {
+		return nil, err
+	}
+	return s.endpoint, nil
+}
 
-	if s.tlsConf == nil {
-		return nil, errors.New("http3: no TLS configured")
+func (s *Server) Start(ctx context.Context) error {
+	if err := s.listenAndEndpoint(); err != nil {
+		return err
 	}
 
-	var prefix string
-	if !strings.HasPrefix(addr, "https://") {
-		prefix = "https://"
+	if s.tcpServer == nil {
+		return s.serveQUIC()
 	}
-	addr = prefix + addr
 
-	s.endpoint, s.err = url.Parse(addr)
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- s.serveQUIC()
+	}()
+	go func() {
+		klog.Info("[HTTP3] tcp server listening", "addr", s.tcpLis.Addr().String())
+		err := s.tcpServer.ServeTLS(s.tcpLis, "", "")
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Error("[HTTP3] tcp server error", "reason", err.Error())
+			errCh <- err
+			return
+		}
+		errCh <- nil
+	}()
 
-	return s.endpoint, s.err
+	// either listener failing takes the other one down with it
+	if err := <-errCh; err != nil {
+		_ = s.Server.Close()
+		_ = s.tcpServer.Close()
+		<-errCh
+		return err
+	}
+	return <-errCh
 }
 
-func (s *Server) Start(ctx context.Context) error {
+func (s *Server) listenAndEndpoint() error {
 	if s.tlsConf == nil {
 		return errors.New("http3: no TLS configured")
 	}
 
-	klog.Info("[HTTP3] server listening", "addr", s.Addr)
-	err := s.ListenAndServe()
+	addr := strings.TrimPrefix(s.address, "https://")
+	hostPort := addr
+	if s.quicLis != nil || s.conn != nil {
+		// an injected listener knows its own address better than s.address
+		hostPort = s.localAddr().String()
+	}
+	if s.quicLis == nil && s.conn == nil {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			s.err = err
+			return err
+		}
+		s.conn = conn
+	}
+	if s.tcpServer != nil && s.tcpLis == nil {
+		// the TCP listener shares the UDP port so that Alt-Svc points back at it
+		host, _, _ := net.SplitHostPort(addr)
+		port, _ := utils.AddrPort(s.localAddr())
+		lis, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			s.err = err
+			return err
+		}
+		s.tcpLis = lis
+	}
+	if s.endpoint == nil {
+		host, err := utils.ExtractHostPort(hostPort, s.localAddr())
+		if err != nil {
+			s.err = err
+			return err
+		}
+		s.endpoint = &url.URL{Scheme: "https", Host: host}
+	}
+	return s.err
+}
+
+func (s *Server) localAddr() net.Addr {
+	if s.quicLis != nil {
+		return s.quicLis.Addr()
+	}
+	return s.conn.LocalAddr()
+}
+
+func (s *Server) serveQUIC() error {
+	klog.Info("[HTTP3] server listening", "addr", s.localAddr().String())
+	var err error
+	if s.quicLis != nil {
+		err = s.ServeListener(s.quicLis)
+	} else {
+		err = s.Serve(s.conn)
+	}
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		klog.Error("[HTTP3] server error", "reason", err.Error())
 		return err
@@ -122,6 +215,13 @@ func (s *Server) Start(ctx context.Context) error {
 	return nil
 }
 
+// serveTCP serves HTTP/1.1 and HTTP/2 requests and advertises HTTP/3 via Alt-Svc.
+func (s *Server) serveTCP(res http.ResponseWriter, req *http.Request) {
+	// no Alt-Svc until the QUIC listener is up
+	_ = s.Server.SetQUICHeaders(res.Header())
+	s.Handler.ServeHTTP(res, req)
+}
+
 // WalkHandle walks the router and all its sub-routers, calling walkFn for each route in the tree.
 func (s *Server) WalkHandle(handle func(method, path string, handler http.HandlerFunc)) error {
 	return s.WalkRoute(func(r khttp.RouteInfo) error {
@@ -133,12 +233,25 @@ func (s *Server) WalkHandle(handle func(method, path string, handler http.Handle
 func (s *Server) Stop(ctx context.Context) error {
 	klog.Info("[HTTP3] server stopping")
 	err := s.Shutdown(ctx)
+	if s.tcpServer != nil {
+		err = errors.Join(err, s.tcpServer.Shutdown(ctx))
+	}
 	if err != nil {
 		if ctx.Err() != nil {
 			klog.Warn("[HTTP3] server couldn't stop gracefully in time, doing force stop")
 			err = s.Server.Close()
+			if s.tcpServer != nil {
+				err = errors.Join(err, s.tcpServer.Close())
+			}
 		}
 	}
+	// the QUIC server never closes the listeners it was handed
+	if s.quicLis != nil {
+		_ = s.quicLis.Close()
+	}
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
 	return err
 }
 
@@ -193,7 +306,6 @@ func (s *Server) filter() mux.MiddlewareFunc {
 			}
 
 			tr := &Transport{
-				endpoint:     s.endpoint.String(),
 				operation:    pathTemplate,
 				pathTemplate: pathTemplate,
 				reqHeader:    headerCarrier(req.Header),
@@ -202,8 +314,25 @@ func (s *Server) filter() mux.MiddlewareFunc {
 				response:     w,
 			}
 
+			if s.endpoint != nil {
+				tr.endpoint = s.endpoint.String()
+			}
 			tr.request = req.WithContext(transport.NewServerContext(ctx, tr))
-			next.ServeHTTP(w, tr.request)
+			if !s.handlerMw {
+				next.ServeHTTP(w, tr.request)
+				return
+			}
+
+			h := func(ctx context.Context, _ any) (any, error) {
+				next.ServeHTTP(w, req.WithContext(withMiddlewareApplied(ctx, tr.Operation())))
+				return nil, nil
+			}
+			if ms := s.middleware.Match(tr.Operation()); len(ms) > 0 {
+				h = middleware.Chain(ms...)(h)
+			}
+			if _, err := h(tr.request.Context(), tr.request); err != nil {
+				s.ene(w, tr.request, err)
+			}
 		})
 	}
 }
@@ -5,13 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	api "github.com/blink-io/kratos-transport/testing/api/protobuf"
 	"github.com/blink-io/kratos-transport/testing/tlsutil"
 
+	"github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/transport"
 	khttp "github.com/go-kratos/kratos/v3/transport/http"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
@@ -62,7 +68,7 @@ func TestServer(t *testing.T) {
 	ctx := context.Background()
 
 	srv := NewServer(
-		Address(":8800"),
+		Address("127.0.0.1:0"),
 		TLSConfig(tlsutil.GenerateTLSConfig()),
 	)
 
@@ -71,15 +77,16 @@ func TestServer(t *testing.T) {
 	//sr := srv.Route("/my")
 	//sr.GET("/info2", GetMyInfo2)
 
-	if err := srv.Start(ctx); err != nil {
-		panic(err)
-	}
-
-	defer func() {
-		if err := srv.Stop(ctx); err != nil {
+	go func() {
+		if err := srv.Start(ctx); err != nil {
 			t.Errorf("expected nil got %v", err)
 		}
 	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := srv.Stop(ctx); err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
 }
 
 func GetHygrothermograph(ctx context.Context, cli *khttp.Client, in *api.Hygrothermograph, opts ...khttp.CallOption) (*api.Hygrothermograph, error) {
@@ -136,11 +143,26 @@ func GetMyInfo2(ctx context.Context, cli *khttp.Client, in *MyInfo2Req, opts ...
 func TestClient(t *testing.T) {
 	ctx := context.Background()
 
+	srv := NewServer(
+		Address("127.0.0.1:0"),
+		TLSConfig(tlsutil.GenerateTLSConfig()),
+	)
+	srv.HandleFunc("/hygrothermograph", HygrothermographHandler)
+	endpoint, err := srv.Endpoint()
+	assert.Nil(t, err)
+	go func() {
+		_ = srv.Start(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
 	var qconf quic.Config
 
 	tlsConf := tlsutil.MustInsecureTLSConfig()
 	cli, err := khttp.NewClient(ctx,
-		khttp.WithEndpoint("127.0.0.1:8800"),
+		khttp.WithEndpoint(endpoint.Host),
 		khttp.WithTLSConfig(tlsConf),
 		khttp.WithTransport(&http3.Transport{TLSClientConfig: tlsConf, QUICConfig: &qconf}),
 	)
@@ -165,3 +187,146 @@ func TestClient(t *testing.T) {
 	//assert.Nil(t, ierr)
 	//t.Log(iresp)
 }
+
+func TestServer_HandlerMiddleware(t *testing.T) {
+	var called []string
+	mw := func(name string) middleware.Middleware {
+		return func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				called = append(called, name)
+				if tr, ok := transport.FromServerContext(ctx); ok && tr.RequestHeader().Get("X-Deny") != "" {
+					return nil, errors.Forbidden("DENIED", "denied")
+				}
+				return handler(ctx, req)
+			}
+		}
+	}
+
+	srv := NewServer(
+		TLSConfig(tlsutil.GenerateTLSConfig()),
+		Middleware(mw("global")),
+		HandlerMiddleware(true),
+	)
+	srv.Use("/plain/*", mw("plain"))
+	srv.HandleFunc("/plain/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := transport.FromServerContext(r.Context())
+		assert.True(t, ok)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv.Route("/").GET("/generated", func(ctx Context) error {
+		h := ctx.Middleware(func(ctx context.Context, req any) (any, error) {
+			return "ok", nil
+		})
+		out, err := h(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return ctx.String(http.StatusOK, out.(string))
+	})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plain/1", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []string{"global", "plain"}, called)
+
+	called = nil
+	req := httptest.NewRequest(http.MethodGet, "/plain/2", nil)
+	req.Header.Set("X-Deny", "1")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	called = nil
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/generated", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"global"}, called)
+
+	// a handler setting its own operation still runs the middleware selected
+	// by that operation, without running the global one twice
+	srv.Use("/api.Greeter/SayHello", mw("operation"))
+	srv.Route("/").GET("/hello", func(ctx Context) error {
+		SetOperation(ctx, "/api.Greeter/SayHello")
+		h := ctx.Middleware(func(ctx context.Context, req any) (any, error) {
+			return "ok", nil
+		})
+		out, err := h(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return ctx.String(http.StatusOK, out.(string))
+	})
+
+	called = nil
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"global", "operation"}, called)
+}
+
+func TestServer_DualStack(t *testing.T) {
+	ctx := context.Background()
+
+	srv := NewServer(
+		Address("127.0.0.1:0"),
+		TLSConfig(tlsutil.GenerateTLSConfig()),
+		DualStack(true),
+	)
+	srv.HandleFunc("/hygrothermograph", HygrothermographHandler)
+	endpoint, err := srv.Endpoint()
+	assert.Nil(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Start(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	tcpCli := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsutil.MustInsecureTLSConfig()}}
+	resp, err := tcpCli.Get(endpoint.String() + "/hygrothermograph")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf(`h3=":%s"; ma=2592000`, endpoint.Port()), resp.Header.Get("Alt-Svc"))
+
+	quicCli := &http.Client{Transport: &http3.Transport{TLSClientConfig: tlsutil.MustInsecureTLSConfig()}}
+	resp, err = quicCli.Get(endpoint.String() + "/hygrothermograph")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, resp.ProtoMajor)
+
+	assert.Nil(t, srv.Stop(ctx))
+	assert.Nil(t, <-errCh)
+}
+
+func TestServer_Listener(t *testing.T) {
+	ctx := context.Background()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	srv := NewServer(
+		Listener(conn),
+		TLSConfig(tlsutil.GenerateTLSConfig()),
+	)
+	srv.HandleFunc("/hygrothermograph", HygrothermographHandler)
+
+	endpoint, err := srv.Endpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://"+conn.LocalAddr().String(), endpoint.String())
+
+	go func() {
+		_ = srv.Start(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	cli := &http.Client{Transport: &http3.Transport{TLSClientConfig: tlsutil.MustInsecureTLSConfig()}}
+	resp, err := cli.Get(endpoint.String() + "/hygrothermograph")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -1,12 +1,30 @@
 package thrift
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/middleware"
 	"github.com/go-kratos/kratos/v3/registry"
+	"github.com/go-kratos/kratos/v3/selector"
+	"github.com/go-kratos/kratos/v3/selector/wrr"
+	"github.com/go-kratos/kratos/v3/transport"
 )
 
+func init() {
+	if selector.GlobalSelector() == nil {
+		selector.SetGlobalSelector(wrr.NewBuilder())
+	}
+}
+
 type clientOptions struct {
 	Client     *thrift.TStandardClient
 	discovery  registry.Discovery
@@ -16,60 +34,345 @@ type clientOptions struct {
 	buffered   bool
 	framed     bool
 	bufferSize int
-	secure     bool
 	tconf      *thrift.TConfiguration
+	service    string
+	httpURL    string
+	timeout    time.Duration
+	middleware []middleware.Middleware
+
+	errorDecoder     ErrorDecoder
+	retry            *RetryPolicy
+	nodeFilters      []selector.NodeFilter
+	discoveryTimeout time.Duration
+
+	poolSize    int
+	idleTimeout time.Duration
+	maxLifetime time.Duration
 }
 
 type Connection struct {
-	Client    *thrift.TStandardClient
+	Client    thrift.TClient
 	Transport thrift.TTransport
+	r         *resolver
+	broken    bool
 }
 
 func (c *Connection) Close() error {
+	if c.r != nil {
+		_ = c.r.Close()
+	}
 	if c.Transport == nil {
 		return nil
 	}
 	return c.Transport.Close()
 }
 
+// Dial opens a single connection to the endpoint. The connection serves one
+// call at a time, so it and the generated service client built on it must not
+// be shared between goroutines, use NewClient for concurrent calls.
 func Dial(opts ...ClientOption) (*Connection, error) {
-	return dial(opts...)
+	d, err := newDialer(opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.dial()
+	if err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	conn.r = d.r
+	return conn, nil
+}
+
+// dialer opens connections to one client endpoint, connections opened
+// through discovery share the dialer resolver.
+type dialer struct {
+	cli              *clientOptions
+	target           *Target
+	protocolFactory  thrift.TProtocolFactory
+	transportFactory thrift.TTransportFactory
+	r                *resolver
+	httpClient       *http.Client
 }
 
-func dial(opts ...ClientOption) (*Connection, error) {
+func newDialer(opts ...ClientOption) (*dialer, error) {
 	cli := &clientOptions{
-		bufferSize: 8192,
-		buffered:   false,
-		framed:     false,
-		protocol:   ProtocolBinary,
-		secure:     false,
-		tconf:      &thrift.TConfiguration{},
+		bufferSize:  8192,
+		buffered:    false,
+		framed:      false,
+		protocol:    ProtocolBinary,
+		tconf:       &thrift.TConfiguration{},
+		poolSize:    10,
+		idleTimeout: time.Minute,
+
+		errorDecoder:     DefaultErrorDecoder,
+		discoveryTimeout: 10 * time.Second,
 	}
 
 	for _, o := range opts {
 		o(cli)
 	}
 
+	target, err := parseTarget(cli.endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var r *resolver
+	if cli.discovery != nil && target.Scheme == schemeDiscovery {
+		if r, err = newResolver(context.Background(), cli.discovery, target, selector.GlobalSelector().Build(), cli.nodeFilters, cli.discoveryTimeout); err != nil {
+			return nil, fmt.Errorf("[Thrift] new resolver failed for endpoint %q: %w", cli.endpoint, err)
+		}
+		if u := r.Endpoint(); u != nil {
+			cli.applyEndpoint(u)
+		}
+	} else if target.Scheme == schemeThrift || target.Scheme == schemeThrifts || target.Scheme == schemeUnix {
+		u, err := url.Parse(cli.endpoint)
+		if err != nil {
+			return nil, err
+		}
+		cli.applyEndpoint(u)
+	}
+
+	d, err := newDialerFor(cli, target, r)
+	if err != nil && r != nil {
+		_ = r.Close()
+	}
+	return d, err
+}
+
+// newDialerFor builds the factories once the client options are final.
+func newDialerFor(cli *clientOptions, target *Target, r *resolver) (*dialer, error) {
+	if cli.tlsConf != nil {
+		// copy so the configuration passed by the caller is left untouched
+		tconf := *cli.tconf
+		tconf.TLSConfig = cli.tlsConf
+		cli.tconf = &tconf
+	}
+
 	protocolFactory := createProtocolFactory(cli.protocol, cli.tconf)
 	if protocolFactory == nil {
 		return nil, ErrInvalidProtocol
 	}
 
-	transportFactory := createTransportFactory(cli.tconf, cli.buffered, cli.framed, cli.bufferSize)
+	// THeader does its own framing
+	framed := cli.framed && cli.protocol != ProtocolHeader
+	transportFactory := createTransportFactory(cli.tconf, cli.buffered, framed, cli.bufferSize)
 	if transportFactory == nil {
 		return nil, ErrInvalidTransport
 	}
 
-	clientTransport, err := createClientTransport(transportFactory, cli.endpoint, cli.secure, cli.tconf)
+	d := &dialer{
+		cli:              cli,
+		target:           target,
+		protocolFactory:  protocolFactory,
+		transportFactory: transportFactory,
+		r:                r,
+	}
+	if cli.httpURL != "" {
+		d.httpClient = newHTTPClient(cli.tlsConf)
+	}
+	return d, nil
+}
+
+// applyEndpoint configures the client the way a thrift:// endpoint advertises
+// the server, the server settings take precedence over the client options.
+func (o *clientOptions) applyEndpoint(u *url.URL) {
+	if u.Scheme == schemeThrifts && o.tlsConf == nil {
+		o.tlsConf = &tls.Config{}
+	}
+	query := u.Query()
+	if protocol := query.Get("protocol"); protocol != "" {
+		o.protocol = protocol
+	}
+	if framed, err := strconv.ParseBool(query.Get("framed")); err == nil {
+		o.framed = framed
+	}
+	if buffered, err := strconv.ParseBool(query.Get("buffered")); err == nil {
+		o.buffered = buffered
+	}
+}
+
+func (d *dialer) dial() (*Connection, error) {
+	return d.dialNode("")
+}
+
+// dialNode opens a connection to addr, or to the client endpoint when addr is empty.
+func (d *dialer) dialNode(addr string) (*Connection, error) {
+	var (
+		socket          thrift.TTransport
+		clientTransport thrift.TTransport
+		err             error
+	)
+	switch {
+	case addr != "":
+		socket = createClientSocket(addr, d.cli.tconf)
+		clientTransport, err = createClientTransport(d.transportFactory, socket)
+	case d.httpClient != nil:
+		// HTTP does its own framing and buffering
+		clientTransport, err = thrift.NewTHttpClientWithOptions(d.cli.httpURL, thrift.THttpClientOptions{Client: d.httpClient})
+	case d.r != nil:
+		socket = newResolverSocket(d.r, func(addr string) thrift.TTransport {
+			return createClientSocket(addr, d.cli.tconf)
+		})
+		clientTransport, err = createClientTransport(d.transportFactory, socket)
+	default:
+		addr := d.target.Authority
+		if d.target.Scheme == schemeUnix {
+			addr = d.cli.endpoint
+		}
+		socket = createClientSocket(addr, d.cli.tconf)
+		clientTransport, err = createClientTransport(d.transportFactory, socket)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	inProto := protocolFactory.GetProtocol(clientTransport)
-	outProto := protocolFactory.GetProtocol(clientTransport)
+	inProto := d.protocolFactory.GetProtocol(clientTransport)
+	outProto := d.protocolFactory.GetProtocol(clientTransport)
+
+	conn := &Connection{Transport: clientTransport}
+
+	var client thrift.TClient
+	if d.cli.service != "" {
+		client = thrift.NewTStandardClient(inProto, thrift.NewTMultiplexedProtocol(outProto, d.cli.service))
+		if hp, ok := outProto.(*thrift.THeaderProtocol); ok {
+			client = multiplexedHeaderClient(hp, client)
+		}
+	} else {
+		client = thrift.NewTStandardClient(inProto, outProto)
+	}
+	client = brokenClient(conn, client)
+	if rs, ok := socket.(*resolverSocket); ok {
+		client = refreshClient(rs, client)
+	}
+	deadliner, _ := socket.(callDeadliner)
+	client = deadlineClient(clientTransport, deadliner, d.cli.timeout, client)
+	if d.cli.retry != nil && d.cli.retry.MaxAttempts > 1 {
+		client = retryClient(clientTransport, socket, d.cli.retry, client)
+	}
+
+	client = headerClient(client)
+	if d.cli.errorDecoder != nil {
+		client = errorClient(d.cli, client)
+	}
+	if len(d.cli.middleware) > 0 {
+		client = middlewareClient(d.cli, client)
+	}
+
+	conn.Client = client
+	return conn, nil
+}
 
-	return &Connection{
-		Client:    thrift.NewTStandardClient(inProto, outProto),
-		Transport: clientTransport,
-	}, nil
+// brokenClient records whether the last call left the connection out of sync,
+// before the error is decorated by the error decoder and the middleware.
+func brokenClient(conn *Connection, next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			meta, err := next.Call(ctx, method, args, result)
+			conn.broken = broken(err)
+			return meta, err
+		},
+	}
+}
+
+func (d *dialer) Close() error {
+	if d.r == nil {
+		return nil
+	}
+	return d.r.Close()
+}
+
+// refreshClient moves the connection to a live endpoint before each call.
+func refreshClient(socket *resolverSocket, next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			if err := socket.refresh(); err != nil {
+				return thrift.ResponseMeta{}, err
+			}
+			return next.Call(ctx, method, args, result)
+		},
+	}
+}
+
+// deadlineClient bounds each call by its context and the default timeout,
+// a call cut short leaves the connection out of sync so it is closed.
+func deadlineClient(trans thrift.TTransport, socket callDeadliner, timeout time.Duration, next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			if socket != nil {
+				if deadline, ok := ctx.Deadline(); ok {
+					socket.setCallDeadline(deadline)
+				}
+				// unblock the socket right away when the call is canceled
+				fired := make(chan struct{})
+				stop := context.AfterFunc(ctx, func() {
+					socket.setCallDeadline(aLongTimeAgo)
+					close(fired)
+				})
+				defer func() {
+					if !stop() {
+						<-fired
+					}
+					socket.setCallDeadline(time.Time{})
+				}()
+			}
+
+			meta, err := next.Call(ctx, method, args, result)
+			if err != nil && ctx.Err() != nil {
+				_ = trans.Close()
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return meta, kerrors.GatewayTimeout("THRIFT_TIMEOUT", "thrift call "+method+" timed out").WithCause(err)
+				}
+				return meta, kerrors.ClientClosed("THRIFT_CANCELED", "thrift call "+method+" canceled").WithCause(err)
+			}
+			return meta, err
+		},
+	}
+}
+
+// middlewareClient runs the client middleware around each call,
+// with a client Transport in the call context.
+func middlewareClient(cli *clientOptions, next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			ctx = transport.NewClientContext(ctx, newClientTransport(cli, method))
+
+			var meta thrift.ResponseMeta
+			h := func(ctx context.Context, _ any) (any, error) {
+				var err error
+				meta, err = next.Call(ctx, method, args, result)
+				if err != nil {
+					return nil, err
+				}
+				return result, nil
+			}
+			h = middleware.Chain(cli.middleware...)(h)
+			_, err := h(ctx, args)
+			return meta, err
+		},
+	}
+}
+
+// newClientTransport returns the client Transport of a call to method.
+func newClientTransport(cli *clientOptions, method string) *Transport {
+	endpoint := cli.endpoint
+	if cli.httpURL != "" {
+		endpoint = cli.httpURL
+	}
+	operation := method
+	if cli.service != "" {
+		operation = cli.service + "/" + method
+	}
+	return &Transport{
+		endpoint:    endpoint,
+		operation:   operation,
+		reqHeader:   headerCarrier{},
+		replyHeader: headerCarrier{},
+	}
 }
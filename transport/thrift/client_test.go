@@ -2,9 +2,17 @@ package thrift
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/apache/thrift/lib/go/thrift"
 	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+	"github.com/blink-io/kratos-transport/testing/tlsutil"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/registry"
+	"github.com/go-kratos/kratos/v3/transport"
 )
 
 func TestClient(t *testing.T) {
@@ -25,3 +33,358 @@ func TestClient(t *testing.T) {
 	}
 	t.Log(*reply.Humidity, *reply.Temperature)
 }
+
+type mockDiscovery struct {
+	ch chan []*registry.ServiceInstance
+}
+
+func newMockDiscovery() *mockDiscovery {
+	return &mockDiscovery{ch: make(chan []*registry.ServiceInstance, 8)}
+}
+
+func (d *mockDiscovery) GetService(_ context.Context, _ string) ([]*registry.ServiceInstance, error) {
+	return nil, nil
+}
+
+func (d *mockDiscovery) Watch(ctx context.Context, _ string) (registry.Watcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &mockWatcher{ctx: ctx, cancel: cancel, ch: d.ch}, nil
+}
+
+func (d *mockDiscovery) publish(endpoints ...string) {
+	services := make([]*registry.ServiceInstance, 0, len(endpoints))
+	for _, e := range endpoints {
+		services = append(services, &registry.ServiceInstance{ID: e, Name: "hygrothermograph", Endpoints: []string{e}})
+	}
+	d.ch <- services
+}
+
+type mockWatcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ch     chan []*registry.ServiceInstance
+}
+
+func (w *mockWatcher) Next() ([]*registry.ServiceInstance, error) {
+	select {
+	case services := <-w.ch:
+		return services, nil
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	}
+}
+
+func (w *mockWatcher) Stop() error {
+	w.cancel()
+	return nil
+}
+
+// startHygrothermographServer starts a server on a free port, opts may set
+// another address, and returns it with the address to dial.
+func startHygrothermographServer(t *testing.T, opts ...ServerOption) (*Server, string) {
+	srv := NewServer(append([]ServerOption{
+		WithAddress("127.0.0.1:0"),
+		WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())),
+	}, opts...)...)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, endpoint.Host
+}
+
+func TestClient_Discovery(t *testing.T) {
+	ctx := context.Background()
+
+	srv1, addr1 := startHygrothermographServer(t)
+	srv2, addr2 := startHygrothermographServer(t)
+	defer func() {
+		_ = srv2.Stop(ctx)
+	}()
+
+	d := newMockDiscovery()
+	d.publish("grpc://127.0.0.1:9000", "tcp://"+addr1)
+
+	conn, err := Dial(
+		WithEndpoint("discovery:///hygrothermograph"),
+		WithDiscovery(d),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := api.NewHygrothermographServiceClient(conn.Client)
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	// move the service to the second server, the stale connection to the
+	// first one is dropped on the next call and the first server can go away
+	d.publish("thrift://" + addr2)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call after update: %v", err)
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	_ = srv1.Stop(stopCtx)
+
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call after first server stopped: %v", err)
+	}
+}
+
+func TestClient_DiscoveryNoEndpoint(t *testing.T) {
+	for name, endpoints := range map[string][]string{
+		"no instance": nil,
+		// an update without a thrift endpoint does not end the wait
+		"no thrift endpoint": {"grpc://127.0.0.1:9000"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := newMockDiscovery()
+			if endpoints != nil {
+				d.publish(endpoints...)
+			}
+
+			start := time.Now()
+			_, err := Dial(
+				WithEndpoint("discovery:///hygrothermograph"),
+				WithDiscovery(d),
+				WithDiscoveryTimeout(200*time.Millisecond),
+			)
+			if !errors.Is(err, ErrNoEndpoint) {
+				t.Fatalf("expected ErrNoEndpoint, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("dial took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestClient_TLS(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t, WithTLSConfig(tlsutil.GenerateTLSConfig()))
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	tconf := &thrift.TConfiguration{}
+	conn, err := Dial(
+		WithEndpoint(addr),
+		WithClientTLSConfig(tlsutil.MustInsecureTLSConfig()),
+		WithClientTConfiguration(tconf),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if tconf.TLSConfig != nil {
+		t.Errorf("expected the passed configuration to be left untouched")
+	}
+
+	client := api.NewHygrothermographServiceClient(conn.Client)
+	reply, err := client.GetHygrothermograph(ctx)
+	if err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	t.Log(*reply.Humidity, *reply.Temperature)
+}
+
+func TestClient_EndpointSettings(t *testing.T) {
+	ctx := context.Background()
+
+	srv := NewServer(
+		WithAddress("127.0.0.1:0"),
+		WithProtocol(ProtocolCompact),
+		WithTransportConfig(true, true, 4096),
+		WithTLSConfig(tlsutil.GenerateTLSConfig()),
+		WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())),
+	)
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.Scheme != "thrifts" {
+		t.Errorf("expected %v got %v", "thrifts", endpoint.Scheme)
+	}
+	if q := endpoint.Query(); q.Get("protocol") != ProtocolCompact || q.Get("framed") != "true" || q.Get("buffered") != "true" {
+		t.Errorf("unexpected endpoint query %v", endpoint.RawQuery)
+	}
+	if err = srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	// dialing the endpoint directly
+	conn, err := Dial(
+		WithEndpoint(endpoint.String()),
+		WithClientTLSConfig(tlsutil.MustInsecureTLSConfig()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call: %v", err)
+	}
+
+	// and through discovery
+	d := newMockDiscovery()
+	d.publish(endpoint.String())
+	conn2, err := Dial(
+		WithEndpoint("discovery:///hygrothermograph"),
+		WithDiscovery(d),
+		WithClientTLSConfig(tlsutil.MustInsecureTLSConfig()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn2.Client).GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call through discovery: %v", err)
+	}
+}
+
+func TestClient_Deadline(t *testing.T) {
+	srv, addr := startSlowServer(t, 300*time.Millisecond)
+	defer func() {
+		_ = srv.Stop(context.Background())
+	}()
+
+	conn, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+	if !kerrors.IsGatewayTimeout(err) {
+		t.Errorf("expected gateway timeout got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("expected the call to be cut at its deadline, took %v", elapsed)
+	}
+	if conn.Transport.IsOpen() {
+		t.Errorf("expected the connection to be closed")
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	srv, addr := startSlowServer(t, 200*time.Millisecond)
+	defer func() {
+		_ = srv.Stop(context.Background())
+	}()
+
+	cli, err := NewClient(
+		WithEndpoint(addr),
+		WithTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	client := api.NewHygrothermographServiceClient(cli)
+	if _, err = client.GetHygrothermograph(context.Background()); !kerrors.IsGatewayTimeout(err) {
+		t.Errorf("expected gateway timeout got %v", err)
+	}
+
+	// a canceled call fails right away
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err = client.GetHygrothermograph(ctx); !kerrors.IsClientClosed(err) {
+		t.Errorf("expected client closed got %v", err)
+	}
+
+	// a longer deadline on the call is still bounded by the default timeout,
+	// and the pool moved on to a fresh connection
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err = client.GetHygrothermograph(ctx); !kerrors.IsGatewayTimeout(err) {
+		t.Errorf("expected gateway timeout got %v", err)
+	}
+}
+
+func TestClient_Middleware(t *testing.T) {
+	ctx := context.Background()
+
+	var serverToken string
+	srv, addr := startHygrothermographServer(t,
+		WithProtocol(ProtocolHeader),
+		Middleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				if tr, ok := transport.FromServerContext(ctx); ok {
+					serverToken = tr.RequestHeader().Get("x-token")
+					tr.ReplyHeader().Set("x-reply", "pong")
+				}
+				return handler(ctx, req)
+			}
+		}),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	var (
+		kind      transport.Kind
+		operation string
+		replied   string
+		reply     any
+	)
+	conn, err := Dial(
+		WithEndpoint(addr),
+		WithClientProtocol(ProtocolHeader),
+		WithMiddleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				tr, ok := transport.FromClientContext(ctx)
+				if !ok {
+					t.Fatal("expected a client transport")
+				}
+				kind = tr.Kind()
+				operation = tr.Operation()
+				tr.RequestHeader().Set("x-token", "secret")
+				rep, err := handler(ctx, req)
+				replied = tr.ReplyHeader().Get("x-reply")
+				reply = rep
+				return rep, err
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	if kind != KindThrift {
+		t.Errorf("expect %v, got %v", KindThrift, kind)
+	}
+	if operation != "getHygrothermograph" {
+		t.Errorf("expect %v, got %v", "getHygrothermograph", operation)
+	}
+	if serverToken != "secret" {
+		t.Errorf("expect %v, got %v", "secret", serverToken)
+	}
+	if replied != "pong" {
+		t.Errorf("expect %v, got %v", "pong", replied)
+	}
+	if _, ok := reply.(*api.HygrothermographServiceGetHygrothermographResult); !ok {
+		t.Errorf("expected the call result as reply, got %T", reply)
+	}
+}
@@ -0,0 +1,205 @@
+package thrift
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	klog "github.com/go-kratos/kratos/v3/log"
+)
+
+// serverConn applies the read and idle timeouts to a server connection,
+// the idle timeout bounds the wait for the next request on the connection.
+// A connection is idle until the first byte of a request is read, the idle
+// flag is only written by the connection goroutine while holding the server lock.
+type serverConn struct {
+	net.Conn
+	srv         *Server
+	readTimeout time.Duration
+	idleTimeout time.Duration
+	idle        bool
+}
+
+func newServerConn(srv *Server, conn net.Conn) *serverConn {
+	return &serverConn{
+		Conn:        conn,
+		srv:         srv,
+		readTimeout: srv.readTimeout,
+		idleTimeout: srv.idleTimeout,
+		idle:        true,
+	}
+}
+
+func (c *serverConn) Read(p []byte) (int, error) {
+	if c.readTimeout > 0 || c.idleTimeout > 0 {
+		timeout := c.readTimeout
+		if c.idle {
+			timeout = c.idleTimeout
+		}
+		var deadline time.Time
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		if err := c.Conn.SetReadDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 && c.idle {
+		c.srv.mu.Lock()
+		c.idle = false
+		c.srv.active++
+		c.srv.mu.Unlock()
+	}
+	return n, err
+}
+
+// waitRequest marks the connection idle before reading the next request,
+// it reports false once the server is shutting down.
+func (c *serverConn) waitRequest() bool {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	if !c.idle {
+		c.idle = true
+		c.srv.active--
+	}
+	return !c.srv.closed
+}
+
+// dispatch hands an accepted connection to the worker pool,
+// the connection is rejected when every worker is busy and the queue is full.
+func (s *Server) dispatch(conn net.Conn) {
+	c := newServerConn(s, conn)
+	if !s.track(c) {
+		return
+	}
+	if s.queue == nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(c)
+		}()
+		return
+	}
+	// a slot is held from the dispatch until the connection is served, so
+	// the limit does not depend on the workers having started to wait
+	select {
+	case s.slots <- struct{}{}:
+		s.queue <- c
+	default:
+		klog.Warn("[Thrift] server saturated, connection rejected", "remote", conn.RemoteAddr().String())
+		s.untrack(c)
+	}
+}
+
+func (s *Server) worker() {
+	defer s.wg.Done()
+	for c := range s.queue {
+		s.serveConn(c)
+		<-s.slots
+	}
+}
+
+func (s *Server) track(c *serverConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		_ = c.Close()
+		return false
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(c *serverConn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	if !c.idle {
+		c.idle = true
+		s.active--
+	}
+	s.mu.Unlock()
+	_ = c.Close()
+}
+
+func (s *Server) serveConn(c *serverConn) {
+	defer s.untrack(c)
+
+	if err := s.processRequests(c); err != nil {
+		klog.Error("[Thrift] error processing request", "remote", c.RemoteAddr().String(), "error", err)
+	}
+}
+
+// processRequests serves the calls of one connection in sequence,
+// the same way thrift.TSimpleServer does.
+func (s *Server) processRequests(c *serverConn) error {
+	client := thrift.NewTSocketFromConnConf(c, s.tconf)
+
+	inputTransport, err := s.transportFactory.GetTransport(client)
+	if err != nil {
+		return err
+	}
+	defer inputTransport.Close()
+	inputProtocol := s.protocolFactory.GetProtocol(inputTransport)
+
+	// THeader replies in the dialect the request was read in,
+	// so the same protocol instance is used both ways
+	outputProtocol := inputProtocol
+	headerProtocol, isHeader := inputProtocol.(*thrift.THeaderProtocol)
+	if !isHeader {
+		outputTransport, err := s.transportFactory.GetTransport(client)
+		if err != nil {
+			return err
+		}
+		defer outputTransport.Close()
+		outputProtocol = s.protocolFactory.GetProtocol(outputTransport)
+	}
+
+	for c.waitRequest() {
+		ctx := thrift.SetResponseHelper(context.Background(), thrift.TResponseHelper{
+			THeaderResponseHelper: thrift.NewTHeaderResponseHelper(outputProtocol),
+		})
+		if isHeader {
+			if err := headerProtocol.ReadFrame(ctx); err != nil {
+				return ignoreClosed(err)
+			}
+			ctx = thrift.AddReadTHeaderToContext(ctx, headerProtocol.GetReadHeaders())
+		}
+
+		ok, err := s.handler.Process(ctx, inputProtocol, outputProtocol)
+		if errors.Is(err, thrift.ErrAbandonRequest) {
+			return nil
+		}
+		if err != nil && errors.As(err, new(thrift.TTransportException)) {
+			return ignoreClosed(err)
+		}
+		var tae thrift.TApplicationException
+		if errors.As(err, &tae) && tae.TypeId() == thrift.UNKNOWN_METHOD {
+			continue
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+// ignoreClosed drops the errors of connections closed by either side or timed out,
+// which are part of the normal connection lifecycle.
+func ignoreClosed(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	var te thrift.TTransportException
+	if errors.As(err, &te) {
+		switch te.TypeId() {
+		case thrift.END_OF_FILE, thrift.NOT_OPEN, thrift.TIMED_OUT:
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package thrift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/transport"
+)
+
+// The reply headers carrying a kratos error next to the TApplicationException
+// which answers a failed call.
+const (
+	errorCodeHeader     = "x-kratos-error-code"
+	errorReasonHeader   = "x-kratos-error-reason"
+	errorMessageHeader  = "x-kratos-error-message"
+	errorMetadataHeader = "x-kratos-error-metadata"
+)
+
+// ErrorEncoder writes the error of a failed call into the reply header,
+// before the exception answering the call is sent.
+type ErrorEncoder func(ctx context.Context, err error, header transport.Header)
+
+// ErrorDecoder turns the error of a call and its reply header into the error
+// returned to the caller.
+type ErrorDecoder func(ctx context.Context, err error, header transport.Header) error
+
+// DefaultErrorEncoder writes the code, reason, message and metadata of the
+// kratos error into the reply header, any other error is sent as unknown.
+// The header reaches the client with the THeader protocol and over HTTP.
+func DefaultErrorEncoder(_ context.Context, err error, header transport.Header) {
+	se := kerrors.FromError(err)
+	if se == nil {
+		return
+	}
+	header.Set(errorCodeHeader, strconv.Itoa(int(se.Code)))
+	header.Set(errorReasonHeader, se.Reason)
+	header.Set(errorMessageHeader, se.Message)
+	if len(se.Metadata) > 0 {
+		if md, err := json.Marshal(se.Metadata); err == nil {
+			header.Set(errorMetadataHeader, string(md))
+		}
+	}
+}
+
+// DefaultErrorDecoder rebuilds the kratos error sent by DefaultErrorEncoder.
+// Without a reply header, as with the binary and compact protocols, the code,
+// reason and message are recovered from the TApplicationException message,
+// which holds the text of the kratos error that failed the call, otherwise
+// the exception is mapped to a kratos error by its type. Transport errors and
+// the exceptions declared in the IDL are returned as is.
+func DefaultErrorDecoder(_ context.Context, err error, header transport.Header) error {
+	if err == nil {
+		return nil
+	}
+	if code := header.Get(errorCodeHeader); code != "" {
+		c, cerr := strconv.Atoi(code)
+		if cerr != nil {
+			c = kerrors.UnknownCode
+		}
+		se := kerrors.New(c, header.Get(errorReasonHeader), header.Get(errorMessageHeader))
+		if md := header.Get(errorMetadataHeader); md != "" {
+			var metadata map[string]string
+			if json.Unmarshal([]byte(md), &metadata) == nil {
+				se = se.WithMetadata(metadata)
+			}
+		}
+		return se.WithCause(err)
+	}
+	var tae thrift.TApplicationException
+	if errors.As(err, &tae) {
+		if tae.TypeId() == thrift.INTERNAL_ERROR {
+			if se := errorFromMessage(tae.Error()); se != nil {
+				return se.WithCause(err)
+			}
+		}
+		code, reason := applicationErrorStatus(tae.TypeId())
+		return kerrors.New(code, reason, tae.Error()).WithCause(err)
+	}
+	return err
+}
+
+// kratosErrorPattern matches the text of a kratos error.
+var kratosErrorPattern = regexp.MustCompile(`(?s)error: code = (\d+) reason = (\S*) message = (.*?) metadata = map\[`)
+
+// errorFromMessage parses the kratos error quoted by an exception message.
+func errorFromMessage(msg string) *kerrors.Error {
+	m := kratosErrorPattern.FindStringSubmatch(msg)
+	if m == nil {
+		return nil
+	}
+	code, err := strconv.Atoi(m[1])
+	if err != nil {
+		return nil
+	}
+	return kerrors.New(code, m[2], m[3])
+}
+
+// applicationErrorStatus maps a TApplicationException type to a kratos code and reason.
+func applicationErrorStatus(typeID int32) (int, string) {
+	switch typeID {
+	case thrift.UNKNOWN_METHOD:
+		return 501, "THRIFT_UNKNOWN_METHOD"
+	case thrift.INVALID_MESSAGE_TYPE_EXCEPTION:
+		return 400, "THRIFT_INVALID_MESSAGE_TYPE"
+	case thrift.PROTOCOL_ERROR:
+		return 400, "THRIFT_PROTOCOL_ERROR"
+	case thrift.INVALID_PROTOCOL:
+		return 400, "THRIFT_INVALID_PROTOCOL"
+	case thrift.INVALID_TRANSFORM:
+		return 400, "THRIFT_INVALID_TRANSFORM"
+	case thrift.UNSUPPORTED_CLIENT_TYPE:
+		return 400, "THRIFT_UNSUPPORTED_CLIENT_TYPE"
+	case thrift.WRONG_METHOD_NAME:
+		return 500, "THRIFT_WRONG_METHOD_NAME"
+	case thrift.BAD_SEQUENCE_ID:
+		return 500, "THRIFT_BAD_SEQUENCE_ID"
+	case thrift.MISSING_RESULT:
+		return 500, "THRIFT_MISSING_RESULT"
+	case thrift.INTERNAL_ERROR:
+		return 500, "THRIFT_INTERNAL_ERROR"
+	}
+	return kerrors.UnknownCode, kerrors.UnknownReason
+}
+
+// errorClient decodes the error of every call with its reply header, a
+// client Transport is put in the context when missing to collect the header.
+func errorClient(cli *clientOptions, next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			tr, ok := transport.FromClientContext(ctx)
+			if !ok {
+				tr = newClientTransport(cli, method)
+				ctx = transport.NewClientContext(ctx, tr)
+			}
+			meta, err := next.Call(ctx, method, args, result)
+			if err != nil {
+				header := tr.ReplyHeader()
+				if _, ok := tr.(*Transport); !ok && meta.Headers != nil {
+					header = headerFromTHeader(meta.Headers)
+				}
+				return meta, cli.errorDecoder(ctx, err, header)
+			}
+			return meta, nil
+		},
+	}
+}
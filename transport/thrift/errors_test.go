@@ -0,0 +1,120 @@
+package thrift
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+)
+
+type failingHygrothermographHandler struct {
+	err error
+}
+
+func (p *failingHygrothermographHandler) GetHygrothermograph(_ context.Context) (*api.Hygrothermograph, error) {
+	return nil, p.err
+}
+
+func TestClient_Error(t *testing.T) {
+	ctx := context.Background()
+
+	handler := &failingHygrothermographHandler{
+		err: kerrors.NotFound("SENSOR_NOT_FOUND", "sensor not found").WithMetadata(map[string]string{"sensor": "s1"}),
+	}
+	srv, addr := startHygrothermographServer(t,
+		WithProtocol(ProtocolHeader),
+		WithProcessor(api.NewHygrothermographServiceProcessor(handler)),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(
+		WithEndpoint(addr),
+		WithClientProtocol(ProtocolHeader),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := api.NewHygrothermographServiceClient(conn.Client)
+	_, err = client.GetHygrothermograph(ctx)
+	se := new(kerrors.Error)
+	if !kerrors.As(err, &se) {
+		t.Fatalf("expected a kratos error got %v", err)
+	}
+	if se.Code != 404 {
+		t.Errorf("expected %v got %v", 404, se.Code)
+	}
+	if se.Reason != "SENSOR_NOT_FOUND" {
+		t.Errorf("expected %v got %v", "SENSOR_NOT_FOUND", se.Reason)
+	}
+	if se.Message != "sensor not found" {
+		t.Errorf("expected %v got %v", "sensor not found", se.Message)
+	}
+	if se.Metadata["sensor"] != "s1" {
+		t.Errorf("expected %v got %v", "s1", se.Metadata["sensor"])
+	}
+
+	// the connection stays usable after an exception
+	if _, err = client.GetHygrothermograph(ctx); !kerrors.IsNotFound(err) {
+		t.Errorf("expected a not found error got %v", err)
+	}
+}
+
+func TestClient_ApplicationError(t *testing.T) {
+	ctx := context.Background()
+
+	handler := &failingHygrothermographHandler{err: kerrors.Forbidden("DENIED", "denied")}
+	srv, addr := startHygrothermographServer(t,
+		WithProcessor(api.NewHygrothermographServiceProcessor(handler)),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the binary protocol has no header, so the error is read from the exception message
+	_, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+	se := kerrors.FromError(err)
+	if se.Code != 403 || se.Reason != "DENIED" || se.Message != "denied" {
+		t.Errorf("expected %v %v got %v %v", 403, "DENIED", se.Code, se.Reason)
+	}
+}
+
+func TestErrorDecoder(t *testing.T) {
+	ctx := context.Background()
+
+	header := headerCarrier{}
+	DefaultErrorEncoder(ctx, kerrors.BadRequest("INVALID", "invalid").WithMetadata(map[string]string{"k": "v"}), header)
+	err := DefaultErrorDecoder(ctx, kerrors.New(500, "", "cause"), header)
+	se := kerrors.FromError(err)
+	if se.Code != 400 || se.Reason != "INVALID" || se.Message != "invalid" || se.Metadata["k"] != "v" {
+		t.Errorf("unexpected error %v", se)
+	}
+
+	if err = DefaultErrorDecoder(ctx, nil, header); err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+
+	// without a header the exception is mapped by its type
+	exc := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "Unknown function ping")
+	se = kerrors.FromError(DefaultErrorDecoder(ctx, exc, headerCarrier{}))
+	if se.Code != 501 || se.Reason != "THRIFT_UNKNOWN_METHOD" {
+		t.Errorf("expected %v %v got %v %v", 501, "THRIFT_UNKNOWN_METHOD", se.Code, se.Reason)
+	}
+	exc = thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing ping: failed")
+	se = kerrors.FromError(DefaultErrorDecoder(ctx, exc, headerCarrier{}))
+	if se.Code != 500 || se.Reason != "THRIFT_INTERNAL_ERROR" {
+		t.Errorf("expected %v %v got %v %v", 500, "THRIFT_INTERNAL_ERROR", se.Code, se.Reason)
+	}
+}
@@ -0,0 +1,98 @@
+package thrift
+
+import (
+	"context"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-kratos/kratos/v3/metadata"
+	"github.com/go-kratos/kratos/v3/transport"
+)
+
+// headerFromTHeader copies THeader key-values read off the wire into a header carrier.
+func headerFromTHeader(headers thrift.THeaderMap) headerCarrier {
+	hc := make(headerCarrier, len(headers))
+	for k, v := range headers {
+		hc.Add(k, v)
+	}
+	return hc
+}
+
+// headerFromContext copies the THeader key-values the server stored in ctx,
+// used when the protocol is wrapped and can't be asked directly.
+func headerFromContext(ctx context.Context) headerCarrier {
+	keys := thrift.GetReadHeaderList(ctx)
+	hc := make(headerCarrier, len(keys))
+	for _, k := range keys {
+		if v, ok := thrift.GetHeader(ctx, k); ok {
+			hc.Add(k, v)
+		}
+	}
+	return hc
+}
+
+// setWriteHeaders sets every header carried by hc onto a THeader protocol,
+// THeader only keeps a single value per key.
+func setWriteHeaders(proto *thrift.THeaderProtocol, hc transport.Header) {
+	proto.ClearWriteHeaders()
+	for _, k := range hc.Keys() {
+		proto.SetWriteHeader(k, hc.Get(k))
+	}
+}
+
+// withClientHeaders stores the client transport request header and the kratos
+// client metadata in ctx, where TStandardClient picks them up for THeader.
+func withClientHeaders(ctx context.Context) context.Context {
+	keys := thrift.GetWriteHeaderList(ctx)
+	set := func(k, v string) {
+		if _, ok := thrift.GetHeader(ctx, k); !ok {
+			keys = append(keys, k)
+		}
+		ctx = thrift.SetHeader(ctx, k, v)
+	}
+	if md, ok := metadata.FromClientContext(ctx); ok {
+		for k, vList := range md {
+			if len(vList) > 0 {
+				set(k, vList[0])
+			}
+		}
+	}
+	if tr, ok := transport.FromClientContext(ctx); ok {
+		header := tr.RequestHeader()
+		for _, k := range header.Keys() {
+			set(k, header.Get(k))
+		}
+	}
+	return thrift.SetWriteHeaderList(ctx, keys)
+}
+
+// headerClient propagates headers through THeader on every call.
+func headerClient(next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			meta, err := next.Call(withClientHeaders(ctx), method, args, result)
+			if tr, ok := transport.FromClientContext(ctx); ok && meta.Headers != nil {
+				if tr, ok := tr.(*Transport); ok {
+					tr.replyHeader = headerFromTHeader(meta.Headers)
+				}
+			}
+			return meta, err
+		},
+	}
+}
+
+// multiplexedHeaderClient sets the THeader write headers itself, TStandardClient
+// only does it when its output protocol is the THeaderProtocol and not a
+// TMultiplexedProtocol wrapping it.
+func multiplexedHeaderClient(proto *thrift.THeaderProtocol, next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			proto.ClearWriteHeaders()
+			for _, k := range thrift.GetWriteHeaderList(ctx) {
+				if v, ok := thrift.GetHeader(ctx, k); ok {
+					proto.SetWriteHeader(k, v)
+				}
+			}
+			return next.Call(ctx, method, args, result)
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package thrift
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	klog "github.com/go-kratos/kratos/v3/log"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/transport"
+)
+
+const contentTypeThrift = "application/x-thrift"
+
+type httpHeaderKey struct{}
+
+// httpHeader carries the HTTP headers of a call served by NewHTTPHandler.
+type httpHeader struct {
+	req   http.Header
+	reply http.Header
+}
+
+// NewHTTPHandler serves thrift calls posted over HTTP, so that it can be mounted
+// on a kratos HTTP or http3 server. The HTTP request and response headers are the
+// request and reply headers of the server Transport.
+func NewHTTPHandler(processor thrift.TProcessor, protocol string, m ...middleware.Middleware) http.Handler {
+	srv := NewServer(WithProtocol(protocol), Middleware(m...))
+	protocolFactory := createProtocolFactory(protocol, srv.tconf)
+	p := newProcessor(srv, "", processor)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if protocolFactory == nil {
+			http.Error(w, ErrInvalidProtocol.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentTypeThrift)
+		// hold the reply back until the middleware and the error encoder are
+		// done with the reply header, which writing the body would commit
+		var reply bytes.Buffer
+		trans := thrift.NewStreamTransport(r.Body, &reply)
+		ctx := context.WithValue(r.Context(), httpHeaderKey{}, httpHeader{req: r.Header, reply: w.Header()})
+		if _, err := p.Process(ctx, protocolFactory.GetProtocol(trans), protocolFactory.GetProtocol(trans)); err != nil {
+			if ignoreClosed(err) != nil {
+				klog.Error("[Thrift] error processing http request", "remote", r.RemoteAddr, "error", err)
+			}
+		}
+		if _, err := w.Write(reply.Bytes()); err != nil {
+			klog.Error("[Thrift] error writing http reply", "remote", r.RemoteAddr, "error", err)
+		}
+	})
+}
+
+// newHTTPClient returns the client used by WithHTTPTransport connections.
+func newHTTPClient(tlsConf *tls.Config) *http.Client {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConf != nil {
+		base.TLSClientConfig = tlsConf
+	}
+	return &http.Client{Transport: &headerRoundTripper{base: base}}
+}
+
+// headerRoundTripper sends the thrift write headers of the call context as HTTP
+// headers, and hands the HTTP response headers to the client Transport.
+type headerRoundTripper struct {
+	base http.RoundTripper
+}
+
+func (t *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	req = req.Clone(ctx)
+	for _, k := range thrift.GetWriteHeaderList(ctx) {
+		if v, ok := thrift.GetHeader(ctx, k); ok {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if tr, ok := transport.FromClientContext(ctx); ok {
+		if tr, ok := tr.(*Transport); ok {
+			tr.replyHeader = headerCarrier(resp.Header)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,131 @@
+package thrift
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/echo"
+	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+	"github.com/go-kratos/kratos/v3/metadata"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/transport"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	var (
+		operation string
+		traceID   string
+		reqID     string
+	)
+	handler := NewHTTPHandler(
+		api.NewHygrothermographServiceProcessor(NewHygrothermographHandler()),
+		ProtocolCompact,
+		func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				if tr, ok := transport.FromServerContext(ctx); ok {
+					operation = tr.Operation()
+					traceID = tr.RequestHeader().Get("x-md-global-trace")
+					reqID = tr.RequestHeader().Get("x-request-id")
+					tr.ReplyHeader().Set("x-reply", "pong")
+				}
+				return handler(ctx, req)
+			}
+		},
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/thrift", handler)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	conn, err := Dial(
+		WithHTTPTransport(ts.URL+"/thrift"),
+		WithClientProtocol(ProtocolCompact),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tr := &Transport{reqHeader: headerCarrier{}, replyHeader: headerCarrier{}}
+	tr.reqHeader.Set("x-request-id", "req-1")
+	ctx := transport.NewClientContext(context.Background(), tr)
+	ctx = metadata.AppendToClientContext(ctx, "x-md-global-trace", "trace-1")
+
+	reply, err := api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+	if err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	if reply.Humidity == nil {
+		t.Errorf("expected reply")
+	}
+	if operation != "HygrothermographService/getHygrothermograph" {
+		t.Errorf("expect %v, got %v", "HygrothermographService/getHygrothermograph", operation)
+	}
+	if traceID != "trace-1" {
+		t.Errorf("expect %v, got %v", "trace-1", traceID)
+	}
+	if reqID != "req-1" {
+		t.Errorf("expect %v, got %v", "req-1", reqID)
+	}
+	if v := tr.ReplyHeader().Get("x-reply"); v != "pong" {
+		t.Errorf("expect %v, got %v", "pong", v)
+	}
+	if v := tr.ReplyHeader().Get("Content-Type"); v != contentTypeThrift {
+		t.Errorf("expect %v, got %v", contentTypeThrift, v)
+	}
+}
+
+func TestHTTPHandler_LargeReply(t *testing.T) {
+	handler := NewHTTPHandler(
+		echo.NewEchoServiceProcessor(echoHandler{}),
+		ProtocolBinary,
+		func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				reply, err := handler(ctx, req)
+				if tr, ok := transport.FromServerContext(ctx); ok {
+					tr.ReplyHeader().Set("x-after", "done")
+				}
+				return reply, err
+			}
+		},
+	)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	conn, err := Dial(WithHTTPTransport(ts.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// replies larger than the stream buffer still carry the headers set after the handler
+	for _, size := range []int{10, 10000} {
+		tr := &Transport{reqHeader: headerCarrier{}, replyHeader: headerCarrier{}}
+		ctx := transport.NewClientContext(context.Background(), tr)
+		msg := strings.Repeat("x", size)
+		reply, err := echo.NewEchoServiceClient(conn.Client).Echo(ctx, &echo.Request{Msg: msg})
+		if err != nil {
+			t.Fatalf("failed to call: %v", err)
+		}
+		if reply.Msg != msg {
+			t.Errorf("expected a %d byte echo got %d bytes", size, len(reply.Msg))
+		}
+		if v := tr.ReplyHeader().Get("x-after"); v != "done" {
+			t.Errorf("%d bytes: expect %v, got %v", size, "done", v)
+		}
+	}
+}
+
+func TestHTTPHandler_MethodNotAllowed(t *testing.T) {
+	handler := NewHTTPHandler(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler()), ProtocolBinary)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/thrift", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expect %v, got %v", http.StatusMethodNotAllowed, w.Code)
+	}
+}
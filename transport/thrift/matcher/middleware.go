@@ -0,0 +1,59 @@
+package matcher
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-kratos/kratos/v3/middleware"
+)
+
+// Matcher is a middleware matcher.
+type Matcher interface {
+	Use(ms ...middleware.Middleware)
+	Add(selector string, ms ...middleware.Middleware)
+	Match(operation string) []middleware.Middleware
+}
+
+// New a middleware matcher.
+func New() Matcher {
+	return &matcher{
+		matches: make(map[string][]middleware.Middleware),
+	}
+}
+
+type matcher struct {
+	prefix   []string
+	defaults []middleware.Middleware
+	matches  map[string][]middleware.Middleware
+}
+
+func (m *matcher) Use(ms ...middleware.Middleware) {
+	m.defaults = ms
+}
+
+func (m *matcher) Add(selector string, ms ...middleware.Middleware) {
+	if strings.HasSuffix(selector, "*") {
+		selector = strings.TrimSuffix(selector, "*")
+		m.prefix = append(m.prefix, selector)
+		sort.Slice(m.prefix, func(i, j int) bool {
+			return len(m.prefix[i]) > len(m.prefix[j])
+		})
+	}
+	m.matches[selector] = ms
+}
+
+func (m *matcher) Match(operation string) []middleware.Middleware {
+	ms := make([]middleware.Middleware, 0, len(m.defaults))
+	if len(m.defaults) > 0 {
+		ms = append(ms, m.defaults...)
+	}
+	if next, ok := m.matches[operation]; ok {
+		return append(ms, next...)
+	}
+	for _, prefix := range m.prefix {
+		if strings.HasPrefix(operation, prefix) {
+			return append(ms, m.matches[prefix]...)
+		}
+	}
+	return ms
+}
@@ -2,9 +2,14 @@ package thrift
 
 import (
 	"crypto/tls"
+	"os"
+	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/middleware/ratelimit"
 	"github.com/go-kratos/kratos/v3/registry"
+	"github.com/go-kratos/kratos/v3/selector"
 )
 
 type ServerOption func(o *Server)
@@ -15,6 +20,13 @@ func WithAddress(addr string) ServerOption {
 	}
 }
 
+// WithUnixSocketMode with the file mode of the Unix socket a unix:// address listens on.
+func WithUnixSocketMode(mode os.FileMode) ServerOption {
+	return func(s *Server) {
+		s.unixSocketMode = mode
+	}
+}
+
 func WithTLSConfig(c *tls.Config) ServerOption {
 	return func(s *Server) {
 		s.tlsConf = c
@@ -47,6 +59,85 @@ func WithTConfiguration(tconf *thrift.TConfiguration) ServerOption {
 	}
 }
 
+// Middleware with service middleware option.
+func Middleware(m ...middleware.Middleware) ServerOption {
+	return func(s *Server) {
+		s.middleware.Use(m...)
+	}
+}
+
+// WithRateLimit with a limiter for the calls of operation, a 'Service/method'
+// name, 'Service/*' or '*' for every call. Like the middleware selectors, the
+// '*' limit applies next to the one of the most specific matching operation,
+// and a later limiter for the same operation replaces the former. A nil
+// limiter is the adaptive BBR limiter of kratos ratelimit. Rejected calls fail
+// with ratelimit.ErrLimitExceed, a 429 RATELIMIT error.
+func WithRateLimit(operation string, limiter ratelimit.Limiter) ServerOption {
+	return func(s *Server) {
+		var opts []ratelimit.Option
+		if limiter != nil {
+			opts = append(opts, ratelimit.WithLimiter(limiter))
+		}
+		if operation == "*" {
+			s.limits.Use(ratelimit.Server(opts...))
+			return
+		}
+		s.limits.Add(operation, ratelimit.Server(opts...))
+	}
+}
+
+// Timeout with the deadline of each call, which cancels the handler context.
+func Timeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+// WithMaxConnections with the number of connections served at the same time,
+// zero serves every connection on its own goroutine.
+func WithMaxConnections(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithConnectionQueueSize with the number of accepted connections waiting for a
+// free worker, connections beyond it are closed right away.
+func WithConnectionQueueSize(n int) ServerOption {
+	return func(s *Server) {
+		s.queueSize = n
+	}
+}
+
+// WithReadTimeout with the maximum time to read a request once it started.
+func WithReadTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.readTimeout = timeout
+	}
+}
+
+// WithIdleTimeout with the maximum time a connection waits for its next request.
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithEnableKeepAlive with a gRPC health service served on a port of its own,
+// for orchestrators probing the readiness of the server.
+func WithEnableKeepAlive(enable bool) ServerOption {
+	return func(s *Server) {
+		s.enableKeepAlive = enable
+	}
+}
+
+// WithErrorEncoder with the encoder writing the error of a failed call into its reply header.
+func WithErrorEncoder(enc ErrorEncoder) ServerOption {
+	return func(s *Server) {
+		s.errorEncoder = enc
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 type ClientOption func(o *clientOptions)
@@ -58,6 +149,28 @@ func WithDiscovery(d registry.Discovery) ClientOption {
 	}
 }
 
+// WithDiscoveryTimeout with the maximum time Dial and NewClient wait for the
+// first endpoints of a discovery target, ErrNoEndpoint is returned after it.
+func WithDiscoveryTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.discoveryTimeout = timeout
+	}
+}
+
+// WithMiddleware with client middleware.
+func WithMiddleware(m ...middleware.Middleware) ClientOption {
+	return func(o *clientOptions) {
+		o.middleware = m
+	}
+}
+
+// WithNodeFilter with select filters applied to the discovered nodes.
+func WithNodeFilter(filters ...selector.NodeFilter) ClientOption {
+	return func(o *clientOptions) {
+		o.nodeFilters = filters
+	}
+}
+
 // WithEndpoint with client endpoint.
 func WithEndpoint(endpoint string) ClientOption {
 	return func(o *clientOptions) {
@@ -86,8 +199,67 @@ func WithClientTransportConfig(buffered, framed bool, bufferSize int) ClientOpti
 	}
 }
 
+// WithMultiplexedService with the service name to call on a server hosting several services.
+func WithMultiplexedService(serviceName string) ClientOption {
+	return func(o *clientOptions) {
+		o.service = serviceName
+	}
+}
+
+// WithHTTPTransport with the URL of a thrift HTTP endpoint, see NewHTTPHandler,
+// the calls are then posted to it instead of going over a socket.
+func WithHTTPTransport(url string) ClientOption {
+	return func(o *clientOptions) {
+		o.httpURL = url
+	}
+}
+
 func WithClientTConfiguration(tconf *thrift.TConfiguration) ClientOption {
 	return func(c *clientOptions) {
 		c.tconf = tconf
 	}
 }
+
+// WithTimeout with the default timeout of a call, a shorter deadline set on
+// the call context wins. Zero disables it.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetry with the policy retrying the calls failing on a broken connection,
+// the timeout set by WithTimeout bounds each attempt.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.retry = &policy
+	}
+}
+
+// WithPoolSize with the maximum number of connections held by a client made with NewClient.
+func WithPoolSize(size int) ClientOption {
+	return func(o *clientOptions) {
+		o.poolSize = size
+	}
+}
+
+// WithPoolIdleTimeout with the time after which an idle pooled connection is closed.
+func WithPoolIdleTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithPoolMaxLifetime with the maximum time a pooled connection is reused.
+func WithPoolMaxLifetime(lifetime time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.maxLifetime = lifetime
+	}
+}
+
+// WithErrorDecoder with the decoder turning the error of a call and its reply header into a kratos error.
+func WithErrorDecoder(dec ErrorDecoder) ClientOption {
+	return func(o *clientOptions) {
+		o.errorDecoder = dec
+	}
+}
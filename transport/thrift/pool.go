@@ -0,0 +1,253 @@
+package thrift
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/selector"
+)
+
+var _ thrift.TClient = (*Client)(nil)
+
+var ErrClientClosed = errors.New("client closed")
+
+// Client is a thrift.TClient backed by bounded pools of connections, one per
+// node when the endpoint is discovered, it is safe for concurrent use. The
+// generated service clients are not, as they record the meta of their last
+// response: wrap the Client in one generated client per goroutine.
+type Client struct {
+	d *dialer
+
+	size        int
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+
+	mu     sync.Mutex
+	pools  map[string]*connPool
+	closed bool
+}
+
+// connPool holds the connections to one address, the empty address stands
+// for the client endpoint.
+type connPool struct {
+	addr    string
+	sem     chan struct{}
+	idle    []*pooledConn
+	removed bool
+}
+
+type pooledConn struct {
+	*Connection
+	pool     *connPool
+	created  time.Time
+	lastUsed time.Time
+}
+
+// NewClient creates a pooled thrift client for the endpoint, connections are
+// opened lazily by the first calls. With discovery, every call picks a node
+// with the client selector and the pools of removed nodes are closed.
+// Generated service clients built on it must not be shared between goroutines.
+func NewClient(opts ...ClientOption) (*Client, error) {
+	d, err := newDialer(opts...)
+	if err != nil {
+		return nil, err
+	}
+	size := d.cli.poolSize
+	if size <= 0 {
+		size = 1
+	}
+	c := &Client{
+		d:           d,
+		size:        size,
+		idleTimeout: d.cli.idleTimeout,
+		maxLifetime: d.cli.maxLifetime,
+		pools:       make(map[string]*connPool),
+	}
+	if c.balanced() {
+		d.r.OnUpdate(c.prune)
+	}
+	return c, nil
+}
+
+// balanced reports whether calls are spread over the discovered nodes.
+func (c *Client) balanced() bool {
+	return c.d.r != nil && c.d.httpClient == nil
+}
+
+// Call runs a single call on a pooled connection, waiting for one to be
+// available when the pool is exhausted.
+func (c *Client) Call(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+	var (
+		addr string
+		done selector.DoneFunc
+	)
+	if c.balanced() {
+		node, d, err := c.d.r.Select(ctx)
+		if err != nil {
+			return thrift.ResponseMeta{}, kerrors.ServiceUnavailable("NODE_NOT_FOUND", err.Error())
+		}
+		addr, done = node.Address(), d
+		ctx = selector.NewPeerContext(ctx, &selector.Peer{Node: node})
+	}
+
+	pc, err := c.get(ctx, addr)
+	if err != nil {
+		if done != nil {
+			done(ctx, selector.DoneInfo{Err: err})
+		}
+		return thrift.ResponseMeta{}, err
+	}
+	meta, err := pc.Client.Call(ctx, method, args, result)
+	c.put(pc)
+	if done != nil {
+		done(ctx, selector.DoneInfo{Err: err, BytesSent: true, BytesReceived: err == nil})
+	}
+	return meta, err
+}
+
+func (c *Client) get(ctx context.Context, addr string) (*pooledConn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	p, ok := c.pools[addr]
+	if !ok {
+		p = &connPool{addr: addr, sem: make(chan struct{}, c.size)}
+		c.pools[addr] = p
+	}
+	c.mu.Unlock()
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	now := time.Now()
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			<-p.sem
+			return nil, ErrClientClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			c.mu.Unlock()
+			break
+		}
+		pc := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		c.mu.Unlock()
+
+		if c.healthy(pc, now) {
+			return pc, nil
+		}
+		_ = pc.Close()
+	}
+
+	conn, err := c.d.dialNode(addr)
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	return &pooledConn{Connection: conn, pool: p, created: now}, nil
+}
+
+// healthy reports whether an idle connection can be reused, the socket
+// IsOpen does a connectivity check so peers that hung up are dropped.
+func (c *Client) healthy(pc *pooledConn, now time.Time) bool {
+	if c.idleTimeout > 0 && now.Sub(pc.lastUsed) > c.idleTimeout {
+		return false
+	}
+	if c.maxLifetime > 0 && now.Sub(pc.created) > c.maxLifetime {
+		return false
+	}
+	return pc.Transport.IsOpen()
+}
+
+// put returns a connection to its pool, connections which failed at the
+// transport or protocol level are closed so the next call reconnects.
+func (c *Client) put(pc *pooledConn) {
+	defer func() { <-pc.pool.sem }()
+
+	if pc.broken {
+		_ = pc.Close()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || pc.pool.removed {
+		_ = pc.Close()
+		return
+	}
+	pc.lastUsed = time.Now()
+	pc.pool.idle = append(pc.pool.idle, pc)
+}
+
+// prune closes the pools of the nodes which left the resolver,
+// connections in use are closed when their call returns.
+func (c *Client) prune(addrs []string) {
+	var idle []*pooledConn
+	c.mu.Lock()
+	for addr, p := range c.pools {
+		if slices.Contains(addrs, addr) {
+			continue
+		}
+		p.removed = true
+		idle = append(idle, p.idle...)
+		p.idle = nil
+		delete(c.pools, addr)
+	}
+	c.mu.Unlock()
+
+	for _, pc := range idle {
+		_ = pc.Close()
+	}
+}
+
+// broken reports whether a call failed with an error leaving its connection
+// unusable, only transport and protocol failures do: an answer from the server
+// leaves the connection in sync.
+func broken(err error) bool {
+	var tErr thrift.TException
+	if !errors.As(err, &tErr) {
+		return false
+	}
+	switch tErr.TExceptionType() {
+	case thrift.TExceptionTypeTransport, thrift.TExceptionTypeProtocol:
+		return true
+	}
+	return false
+}
+
+// Close closes the idle connections and the discovery watcher, connections
+// in use are closed when their call returns.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	var idle []*pooledConn
+	for _, p := range c.pools {
+		idle = append(idle, p.idle...)
+		p.idle = nil
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, pc := range idle {
+		errs = append(errs, pc.Close())
+	}
+	errs = append(errs, c.d.Close())
+	return errors.Join(errs...)
+}
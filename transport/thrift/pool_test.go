@@ -0,0 +1,289 @@
+package thrift
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/middleware"
+)
+
+func TestClient_Pool(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	cli, err := NewClient(
+		WithEndpoint(addr),
+		WithPoolSize(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the generated client is not safe for concurrent use, the pool is
+			client := api.NewHygrothermographServiceClient(cli)
+			for j := 0; j < 4; j++ {
+				if _, err := client.GetHygrothermograph(ctx); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("failed to call: %v", err)
+	}
+
+	cli.mu.Lock()
+	idle := len(cli.pools[""].idle)
+	cli.mu.Unlock()
+	if idle == 0 || idle > 4 {
+		t.Errorf("expected between 1 and 4 idle connections got %d", idle)
+	}
+}
+
+func TestClient_PoolIdleTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	cli, err := NewClient(
+		WithEndpoint(addr),
+		WithPoolSize(1),
+		WithPoolIdleTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	client := api.NewHygrothermographServiceClient(cli)
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	first := cli.pools[""].idle[0]
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	if cli.pools[""].idle[0] == first {
+		t.Errorf("expected the idle connection to be replaced")
+	}
+}
+
+func TestClient_PoolBrokenConnection(t *testing.T) {
+	// a peer that hangs up on every connection
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	cli, err := NewClient(WithEndpoint(lis.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := api.NewHygrothermographServiceClient(cli)
+	if _, err = client.GetHygrothermograph(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(cli.pools[""].idle) != 0 {
+		t.Errorf("expected the broken connection to be dropped")
+	}
+
+	if err = cli.Close(); err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+	if _, err = client.GetHygrothermograph(context.Background()); err != ErrClientClosed {
+		t.Errorf("expected %v got %v", ErrClientClosed, err)
+	}
+}
+
+func TestClient_PoolRejectedCall(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	var reject atomic.Bool
+	cli, err := NewClient(
+		WithEndpoint(addr),
+		WithPoolSize(1),
+		WithMiddleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				if reject.Load() {
+					return nil, kerrors.Forbidden("REJECTED", "rejected")
+				}
+				return handler(ctx, req)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	client := api.NewHygrothermographServiceClient(cli)
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	first := cli.pools[""].idle[0]
+
+	// a call rejected before it was sent leaves the connection in the pool
+	reject.Store(true)
+	if _, err = client.GetHygrothermograph(ctx); !kerrors.IsForbidden(err) {
+		t.Fatalf("expected a rejected call got %v", err)
+	}
+	cli.mu.Lock()
+	idle := cli.pools[""].idle
+	cli.mu.Unlock()
+	if len(idle) != 1 || idle[0] != first {
+		t.Errorf("expected the connection to be kept got %d idle connections", len(idle))
+	}
+}
+
+func TestClient_PoolBrokenCallDecorated(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	handler := funcHygrothermographHandler(func(ctx context.Context) (*api.Hygrothermograph, error) {
+		if calls.Add(1) == 1 {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return NewHygrothermographHandler().GetHygrothermograph(ctx)
+	})
+	srv, addr := startHygrothermographServer(t,
+		WithProcessor(api.NewHygrothermographServiceProcessor(handler)),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	cli, err := NewClient(
+		WithEndpoint(addr),
+		WithPoolSize(1),
+		WithClientTConfiguration(&thrift.TConfiguration{SocketTimeout: 100 * time.Millisecond}),
+		// the error of a failed call is replaced without its cause
+		WithMiddleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				reply, err := handler(ctx, req)
+				if err != nil {
+					return nil, errors.New("call failed")
+				}
+				return reply, nil
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	client := api.NewHygrothermographServiceClient(cli)
+	if _, err = client.GetHygrothermograph(ctx); err == nil {
+		t.Fatal("expected the call to time out")
+	}
+	// the timed out connection is not reused, its reply is still on the way
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call: %v", err)
+	}
+}
+
+func TestClient_PoolBalancer(t *testing.T) {
+	ctx := context.Background()
+
+	var calls [2]atomic.Int32
+	counter := func(i int) ServerOption {
+		return Middleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				calls[i].Add(1)
+				return handler(ctx, req)
+			}
+		})
+	}
+	srv1, addr1 := startHygrothermographServer(t, counter(0))
+	srv2, addr2 := startHygrothermographServer(t, counter(1))
+	defer func() {
+		_ = srv1.Stop(ctx)
+		_ = srv2.Stop(ctx)
+	}()
+
+	d := newMockDiscovery()
+	d.publish("tcp://"+addr1, "tcp://"+addr2)
+
+	cli, err := NewClient(
+		WithEndpoint("discovery:///hygrothermograph"),
+		WithDiscovery(d),
+		WithPoolSize(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	client := api.NewHygrothermographServiceClient(cli)
+	for i := 0; i < 20; i++ {
+		if _, err = client.GetHygrothermograph(ctx); err != nil {
+			t.Fatalf("failed to call: %v", err)
+		}
+	}
+	if calls[0].Load() == 0 || calls[1].Load() == 0 {
+		t.Errorf("expected calls on both nodes got %d and %d", calls[0].Load(), calls[1].Load())
+	}
+
+	// the pool of a node removed by the watcher is closed
+	d.publish("tcp://" + addr2)
+	time.Sleep(100 * time.Millisecond)
+
+	cli.mu.Lock()
+	_, ok := cli.pools[addr1]
+	cli.mu.Unlock()
+	if ok {
+		t.Errorf("expected the pool of the removed node to be closed")
+	}
+
+	before := calls[0].Load()
+	for i := 0; i < 10; i++ {
+		if _, err = client.GetHygrothermograph(ctx); err != nil {
+			t.Fatalf("failed to call after update: %v", err)
+		}
+	}
+	if calls[0].Load() != before {
+		t.Errorf("expected no call on the removed node")
+	}
+}
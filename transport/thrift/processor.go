@@ -0,0 +1,241 @@
+package thrift
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	klog "github.com/go-kratos/kratos/v3/log"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/transport"
+)
+
+var _ thrift.TProcessor = (*processor)(nil)
+
+// processor dispatches thrift calls to the wrapped processor functions,
+// running each call through the server middleware.
+type processor struct {
+	srv     *Server
+	service string
+	thrift.TProcessor
+}
+
+func newProcessor(srv *Server, service string, p thrift.TProcessor) *processor {
+	if service == "" {
+		service = serviceName(p)
+	}
+	return &processor{srv: srv, service: service, TProcessor: p}
+}
+
+// serviceName derives the IDL service name from a generated processor,
+// e.g. *HygrothermographServiceProcessor -> HygrothermographService.
+func serviceName(p thrift.TProcessor) string {
+	t := reflect.TypeOf(p)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(t.Name(), "Processor")
+}
+
+func (p *processor) Process(ctx context.Context, in, out thrift.TProtocol) (bool, thrift.TException) {
+	name, typeID, seqID, err := in.ReadMessageBegin(ctx)
+	if err != nil {
+		return false, thrift.WrapTException(err)
+	}
+
+	fn, ok := p.ProcessorMap()[name]
+	if !ok {
+		_ = in.Skip(ctx, thrift.STRUCT)
+		_ = in.ReadMessageEnd(ctx)
+		exc := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "Unknown function "+name)
+		_ = writeException(ctx, out, name, seqID, exc)
+		return false, exc
+	}
+
+	return p.call(ctx, name, typeID, seqID, fn, in, out)
+}
+
+func (p *processor) call(ctx context.Context, name string, typeID thrift.TMessageType, seqID int32,
+	fn thrift.TProcessorFunction, in, out thrift.TProtocol,
+) (bool, thrift.TException) {
+	tr := &Transport{
+		endpoint:    p.srv.endpointString(),
+		operation:   p.service + "/" + name,
+		reqHeader:   headerCarrier{},
+		replyHeader: headerCarrier{},
+	}
+	if hh, ok := ctx.Value(httpHeaderKey{}).(httpHeader); ok {
+		tr.reqHeader = headerCarrier(hh.req)
+		tr.replyHeader = headerCarrier(hh.reply)
+	} else if hp, ok := in.(*thrift.THeaderProtocol); ok {
+		tr.reqHeader = headerFromTHeader(hp.GetReadHeaders())
+	} else if _, ok := out.(*thrift.THeaderProtocol); ok {
+		// the input is wrapped by TMultiplexedProcessor
+		tr.reqHeader = headerFromContext(ctx)
+	}
+	ctx = transport.NewServerContext(ctx, tr)
+	if p.srv.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.srv.timeout)
+		defer cancel()
+	}
+
+	rin := &messageReader{TProtocol: in}
+	rout := &messageWriter{TProtocol: out, header: tr.replyHeader}
+
+	var success, panicked bool
+	// recoverPanic turns a panic of the processor or of a middleware into an error
+	recoverPanic := func(err *error) {
+		if rerr := recover(); rerr != nil {
+			buf := make([]byte, 64<<10)
+			buf = buf[:runtime.Stack(buf, false)]
+			klog.Error("[Thrift] handler panic recovered", "operation", tr.Operation(), "panic", rerr, "stack", string(buf))
+			panicked = true
+			*err = kerrors.InternalServer("THRIFT_PANIC", fmt.Sprintf("panic processing %s: %v", name, rerr))
+		}
+	}
+	h := func(ctx context.Context, _ any) (_ any, err error) {
+		defer recoverPanic(&err)
+		var exc thrift.TException
+		success, exc = fn.Process(ctx, seqID, rin, rout)
+		if exc != nil {
+			return nil, exc
+		}
+		return nil, nil
+	}
+	// limits run inside the middleware, so that Telemetry records the rejected calls
+	if ms := p.srv.limits.Match(tr.Operation()); len(ms) > 0 {
+		h = middleware.Chain(ms...)(h)
+	}
+	if ms := p.srv.middleware.Match(tr.Operation()); len(ms) > 0 {
+		h = middleware.Chain(ms...)(h)
+	}
+
+	err := func() (err error) {
+		defer recoverPanic(&err)
+		_, err = h(ctx, nil)
+		return err
+	}()
+	if panicked && rout.written {
+		// the reply was cut short, the connection is out of sync
+		return false, thrift.WrapTException(err)
+	}
+	if !rin.done {
+		// the chain rejected the call before the processor read the arguments,
+		// drain them so that the next message is read from its start
+		_ = in.Skip(ctx, thrift.STRUCT)
+		_ = in.ReadMessageEnd(ctx)
+		if typeID == thrift.ONEWAY {
+			// there is no reply to a oneway call
+			return true, thrift.WrapTException(err)
+		}
+	}
+	if rout.written || typeID == thrift.ONEWAY {
+		if rout.exception {
+			p.encodeError(ctx, err, tr.replyHeader)
+		}
+		if ferr := rout.flush(ctx); ferr != nil {
+			return false, thrift.WrapTException(ferr)
+		}
+		return success, thrift.WrapTException(err)
+	}
+
+	// the chain rejected the call before the processor replied,
+	// so answer with an exception ourselves
+	var exc thrift.TApplicationException
+	if err != nil {
+		exc = thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing "+name+": "+err.Error())
+	} else {
+		// a middleware returned without calling the processor nor failing
+		exc = thrift.NewTApplicationException(thrift.MISSING_RESULT, name+" failed: no result")
+	}
+	p.encodeError(ctx, err, tr.replyHeader)
+	if werr := writeException(ctx, rout, name, seqID, exc); werr != nil {
+		return false, thrift.WrapTException(werr)
+	}
+	if werr := rout.flush(ctx); werr != nil {
+		return false, thrift.WrapTException(werr)
+	}
+	return true, exc
+}
+
+func (p *processor) encodeError(ctx context.Context, err error, header headerCarrier) {
+	if err != nil && p.srv.errorEncoder != nil {
+		p.srv.errorEncoder(ctx, err, header)
+	}
+}
+
+func writeException(ctx context.Context, out thrift.TProtocol, name string, seqID int32, exc thrift.TApplicationException) error {
+	if err := out.WriteMessageBegin(ctx, name, thrift.EXCEPTION, seqID); err != nil {
+		return err
+	}
+	if err := exc.Write(ctx, out); err != nil {
+		return err
+	}
+	if err := out.WriteMessageEnd(ctx); err != nil {
+		return err
+	}
+	return out.Flush(ctx)
+}
+
+// messageReader records whether the processor function consumed the request.
+type messageReader struct {
+	thrift.TProtocol
+	done bool
+}
+
+func (r *messageReader) ReadMessageEnd(ctx context.Context) error {
+	r.done = true
+	return r.TProtocol.ReadMessageEnd(ctx)
+}
+
+// messageWriter records whether the processor function started a reply and
+// holds back its end, so that middleware and the error encoder can still add
+// to the reply header, which is attached to the reply when speaking THeader.
+type messageWriter struct {
+	thrift.TProtocol
+	header    headerCarrier
+	written   bool
+	exception bool
+	ended     bool
+	pending   bool
+}
+
+func (w *messageWriter) WriteMessageBegin(ctx context.Context, name string, typeID thrift.TMessageType, seqID int32) error {
+	w.written = true
+	w.exception = typeID == thrift.EXCEPTION
+	return w.TProtocol.WriteMessageBegin(ctx, name, typeID, seqID)
+}
+
+// WriteMessageEnd is held back as THeader sends the message once it ends.
+func (w *messageWriter) WriteMessageEnd(context.Context) error {
+	w.ended = true
+	return nil
+}
+
+func (w *messageWriter) Flush(context.Context) error {
+	w.pending = true
+	return nil
+}
+
+// flush sends the reply held back by WriteMessageEnd and Flush.
+func (w *messageWriter) flush(ctx context.Context) error {
+	if hp, ok := w.TProtocol.(*thrift.THeaderProtocol); ok && w.ended {
+		setWriteHeaders(hp, w.header)
+	}
+	if w.ended {
+		w.ended = false
+		if err := w.TProtocol.WriteMessageEnd(ctx); err != nil {
+			return err
+		}
+	}
+	if !w.pending {
+		return nil
+	}
+	w.pending = false
+	return w.TProtocol.Flush(ctx)
+}
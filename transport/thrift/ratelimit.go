@@ -0,0 +1,63 @@
+package thrift
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v3/middleware/ratelimit"
+)
+
+var _ ratelimit.Limiter = (*tokenBucket)(nil)
+
+// tokenBucket lets rate calls a second through, with bursts of up to burst calls.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter returns a limiter letting rate calls a second through,
+// with bursts of up to burst calls, at least one.
+func NewTokenBucketLimiter(rate float64, burst int) ratelimit.Limiter {
+	burst = max(burst, 1)
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *tokenBucket) Allow() (ratelimit.DoneFunc, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return nil, ratelimit.ErrLimitExceed
+	}
+	b.tokens--
+	return func(ratelimit.DoneInfo) {}, nil
+}
+
+var _ ratelimit.Limiter = (concurrencyLimiter)(nil)
+
+// concurrencyLimiter lets up to cap calls run at the same time.
+type concurrencyLimiter chan struct{}
+
+// NewConcurrencyLimiter returns a limiter letting up to n calls run at the
+// same time, at least one.
+func NewConcurrencyLimiter(n int) ratelimit.Limiter {
+	return make(concurrencyLimiter, max(n, 1))
+}
+
+func (l concurrencyLimiter) Allow() (ratelimit.DoneFunc, error) {
+	select {
+	case l <- struct{}{}:
+		return func(ratelimit.DoneInfo) { <-l }, nil
+	default:
+		return nil, ratelimit.ErrLimitExceed
+	}
+}
@@ -0,0 +1,171 @@
+package thrift
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/middleware/ratelimit"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestServer_RateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	reader := sdkmetric.NewManualReader()
+	srv, addr := startHygrothermographServer(t,
+		WithProtocol(ProtocolHeader),
+		Middleware(Telemetry(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))),
+		WithRateLimit("HygrothermographService/getHygrothermograph", NewTokenBucketLimiter(0.001, 2)),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(WithEndpoint(addr), WithClientProtocol(ProtocolHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := api.NewHygrothermographServiceClient(conn.Client)
+	for i := 0; i < 2; i++ {
+		if _, err = client.GetHygrothermograph(ctx); err != nil {
+			t.Fatalf("failed to call: %v", err)
+		}
+	}
+	_, err = client.GetHygrothermograph(ctx)
+	if !kerrors.IsTooManyRequests(err) || kerrors.Reason(err) != "RATELIMIT" {
+		t.Errorf("expected a rate limit error got %v", err)
+	}
+
+	// the rejected call is seen by the middleware
+	var rm metricdata.ResourceMetrics
+	if err = reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if requests, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == "rpc.server.requests" {
+				for _, dp := range requests.DataPoints {
+					result, _ := dp.Attributes.Value("result")
+					results[result.AsString()] += dp.Value
+				}
+			}
+		}
+	}
+	if results[resultOK] != 2 || results[resultError] != 1 {
+		t.Errorf("expected 2 served and 1 rejected calls got %v", results)
+	}
+}
+
+type blockingHygrothermographHandler struct {
+	*HygrothermographHandler
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingHygrothermographHandler) GetHygrothermograph(ctx context.Context) (*api.Hygrothermograph, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return p.HygrothermographHandler.GetHygrothermograph(ctx)
+}
+
+func TestServer_ConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+
+	handler := &blockingHygrothermographHandler{
+		HygrothermographHandler: NewHygrothermographHandler(),
+		started:                 make(chan struct{}, 1),
+		release:                 make(chan struct{}),
+	}
+	srv, addr := startHygrothermographServer(t,
+		WithProcessor(api.NewHygrothermographServiceProcessor(handler)),
+		WithRateLimit("*", NewConcurrencyLimiter(1)),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	dial := func() *api.HygrothermographServiceClient {
+		conn, err := Dial(WithEndpoint(addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return api.NewHygrothermographServiceClient(conn.Client)
+	}
+
+	first := make(chan error, 1)
+	client := dial()
+	go func() {
+		_, err := client.GetHygrothermograph(ctx)
+		first <- err
+	}()
+	<-handler.started
+
+	// the binary protocol carries the rate limit error in the exception
+	if _, err := dial().GetHygrothermograph(ctx); !kerrors.IsTooManyRequests(err) || kerrors.Reason(err) != "RATELIMIT" {
+		t.Errorf("expected a rate limit error got %v", err)
+	}
+
+	close(handler.release)
+	if err := <-first; err != nil {
+		t.Errorf("failed to call: %v", err)
+	}
+}
+
+func TestServer_RateLimitSelectors(t *testing.T) {
+	srv := NewServer(
+		WithRateLimit("*", nil),
+		WithRateLimit("Calculator/*", nil),
+		WithRateLimit("Calculator/calculate", nil),
+	)
+	if n := len(srv.limits.Match("Calculator/calculate")); n != 2 {
+		t.Errorf("expected 2 limits got %d", n)
+	}
+	if n := len(srv.limits.Match("Calculator/ping")); n != 2 {
+		t.Errorf("expected 2 limits got %d", n)
+	}
+	if n := len(srv.limits.Match("HygrothermographService/getHygrothermograph")); n != 1 {
+		t.Errorf("expected 1 limit got %d", n)
+	}
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	l := NewTokenBucketLimiter(20, 1)
+	if _, err := l.Allow(); err != nil {
+		t.Fatalf("expected the first call to pass got %v", err)
+	}
+	if _, err := l.Allow(); err == nil {
+		t.Errorf("expected the burst to be exhausted")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := l.Allow(); err != nil {
+		t.Errorf("expected a token to be refilled got %v", err)
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	// a limiter always lets one call through
+	if _, err := NewConcurrencyLimiter(0).Allow(); err != nil {
+		t.Errorf("expected a call to pass got %v", err)
+	}
+
+	l := NewConcurrencyLimiter(1)
+	done, err := l.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.Allow(); err == nil {
+		t.Errorf("expected the second call to be rejected")
+	}
+	done(ratelimit.DoneInfo{})
+	if _, err = l.Allow(); err != nil {
+		t.Errorf("expected a call to pass once the first is done got %v", err)
+	}
+}
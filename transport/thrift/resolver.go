@@ -0,0 +1,339 @@
+package thrift
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	klog "github.com/go-kratos/kratos/v3/log"
+	"github.com/go-kratos/kratos/v3/registry"
+	"github.com/go-kratos/kratos/v3/selector"
+)
+
+const (
+	schemeDiscovery = "discovery"
+	schemeTCP       = "tcp"
+	schemeThrift    = "thrift"
+	schemeThrifts   = "thrifts"
+	schemeUnix      = "unix"
+)
+
+var ErrNoEndpoint = errors.New("no available endpoint")
+
+// Target is resolver target
+type Target struct {
+	Scheme    string
+	Authority string
+	Endpoint  string
+}
+
+func parseTarget(endpoint string) (*Target, error) {
+	if !strings.Contains(endpoint, "://") {
+		return &Target{Authority: endpoint}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	target := &Target{Scheme: u.Scheme, Authority: u.Host}
+	if len(u.Path) > 1 {
+		target.Endpoint = u.Path[1:]
+	}
+	return target, nil
+}
+
+// parseEndpoint returns the first thrift endpoint of a service instance.
+func parseEndpoint(endpoints []string) (*url.URL, error) {
+	for _, e := range endpoints {
+		u, err := url.Parse(e)
+		if err != nil {
+			return nil, err
+		}
+		switch u.Scheme {
+		case schemeTCP, schemeThrift, schemeThrifts, schemeUnix:
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+// endpointAddress returns the address dialed for an endpoint, the host and
+// port, or the socket path of a Unix endpoint.
+func endpointAddress(u *url.URL) string {
+	if u.Scheme == schemeUnix {
+		return schemeUnix + "://" + u.Host + u.Path
+	}
+	return u.Host
+}
+
+type resolver struct {
+	target   *Target
+	watcher  registry.Watcher
+	selector selector.Selector
+	filters  []selector.NodeFilter
+
+	mu        sync.RWMutex
+	addrs     []string
+	endpoints []*url.URL
+	updates   []func(addrs []string)
+}
+
+func newResolver(ctx context.Context, discovery registry.Discovery, target *Target,
+	balancer selector.Selector, filters []selector.NodeFilter, timeout time.Duration,
+) (*resolver, error) {
+	watcher, err := discovery.Watch(ctx, target.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	r := &resolver{
+		target:   target,
+		watcher:  watcher,
+		selector: balancer,
+		filters:  filters,
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		pending := true
+		for {
+			services, err := watcher.Next()
+			if err != nil {
+				if pending {
+					ready <- err
+					return
+				}
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				klog.Error("[Thrift] client watch service got unexpected error", "target", target, "error", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			if r.update(services) && pending {
+				pending = false
+				ready <- nil
+			}
+		}
+	}()
+
+	// block until the first endpoints are known, or the timeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-ready:
+		if err != nil {
+			_ = watcher.Stop()
+			return nil, err
+		}
+		return r, nil
+	case <-timer.C:
+		_ = watcher.Stop()
+		return nil, ErrNoEndpoint
+	}
+}
+
+// update applies the endpoints of services, it reports false when none of
+// them has a thrift endpoint and the previous ones are kept.
+func (r *resolver) update(services []*registry.ServiceInstance) bool {
+	addrs := make([]string, 0, len(services))
+	endpoints := make([]*url.URL, 0, len(services))
+	nodes := make([]selector.Node, 0, len(services))
+	for _, ins := range services {
+		ept, err := parseEndpoint(ins.Endpoints)
+		if err != nil {
+			klog.Error("[Thrift] failed to parse discovery endpoint", "target", r.target, "endpoints", ins.Endpoints, "error", err)
+			continue
+		}
+		if ept == nil {
+			continue
+		}
+		addr := endpointAddress(ept)
+		addrs = append(addrs, addr)
+		endpoints = append(endpoints, ept)
+		nodes = append(nodes, selector.NewNode(ept.Scheme, addr, ins))
+	}
+	if len(addrs) == 0 {
+		klog.Warn("[Thrift] zero endpoint found, refused to write", "endpoint", r.target.Endpoint)
+		return false
+	}
+
+	r.selector.Apply(nodes)
+
+	r.mu.Lock()
+	r.addrs = addrs
+	r.endpoints = endpoints
+	updates := r.updates
+	r.mu.Unlock()
+
+	for _, fn := range updates {
+		fn(addrs)
+	}
+	return true
+}
+
+// OnUpdate registers fn to be called with the new addresses after every update.
+func (r *resolver) OnUpdate(fn func(addrs []string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, fn)
+}
+
+// Select picks a node with the client selector, done reports the result of
+// the calls made to it.
+func (r *resolver) Select(ctx context.Context) (selector.Node, selector.DoneFunc, error) {
+	node, done, err := r.selector.Select(ctx, selector.WithNodeFilter(r.filters...))
+	if err != nil {
+		return nil, nil, ErrNoEndpoint
+	}
+	return node, done, nil
+}
+
+// Endpoint returns one of the resolved endpoints, instances of a service
+// are expected to share the same protocol settings.
+func (r *resolver) Endpoint() *url.URL {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.endpoints) == 0 {
+		return nil
+	}
+	return r.endpoints[0]
+}
+
+func (r *resolver) Close() error {
+	return r.watcher.Stop()
+}
+
+var (
+	_ thrift.TTransport = (*resolverSocket)(nil)
+	_ callDeadliner     = (*resolverSocket)(nil)
+)
+
+// resolverSocket is a socket whose address is picked from a resolver each time
+// it is opened, and which goes stale once its address leaves the resolver.
+type resolverSocket struct {
+	r         *resolver
+	newSocket func(addr string) thrift.TTransport
+
+	mu       sync.Mutex
+	sock     thrift.TTransport
+	addr     string
+	stale    bool
+	deadline time.Time
+}
+
+func newResolverSocket(r *resolver, newSocket func(addr string) thrift.TTransport) *resolverSocket {
+	s := &resolverSocket{r: r, newSocket: newSocket}
+	r.OnUpdate(func(addrs []string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.sock != nil && !slices.Contains(addrs, s.addr) {
+			s.stale = true
+		}
+	})
+	return s
+}
+
+func (s *resolverSocket) Open() error {
+	node, done, err := s.r.Select(context.Background())
+	if err != nil {
+		return thrift.NewTTransportExceptionFromError(err)
+	}
+	addr := node.Address()
+	sock := s.newSocket(addr)
+	err = sock.Open()
+	done(context.Background(), selector.DoneInfo{Err: err})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sock != nil {
+		_ = s.sock.Close()
+	}
+	s.sock, s.addr, s.stale = sock, addr, false
+	if d, ok := sock.(callDeadliner); ok {
+		d.setCallDeadline(s.deadline)
+	}
+	return nil
+}
+
+func (s *resolverSocket) setCallDeadline(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	if d, ok := s.sock.(callDeadliner); ok {
+		d.setCallDeadline(t)
+	}
+}
+
+// refresh reconnects when the socket is closed or its address was removed,
+// it must only be called between calls.
+func (s *resolverSocket) refresh() error {
+	s.mu.Lock()
+	reopen := s.sock == nil || s.stale || !s.sock.IsOpen()
+	s.mu.Unlock()
+	if !reopen {
+		return nil
+	}
+	return s.Open()
+}
+
+func (s *resolverSocket) current() thrift.TTransport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sock
+}
+
+func (s *resolverSocket) IsOpen() bool {
+	sock := s.current()
+	return sock != nil && sock.IsOpen()
+}
+
+func (s *resolverSocket) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sock == nil {
+		return nil
+	}
+	err := s.sock.Close()
+	s.sock = nil
+	return err
+}
+
+func (s *resolverSocket) Read(p []byte) (int, error) {
+	sock := s.current()
+	if sock == nil {
+		return 0, thrift.NewTTransportException(thrift.NOT_OPEN, "socket is not open")
+	}
+	return sock.Read(p)
+}
+
+func (s *resolverSocket) Write(p []byte) (int, error) {
+	sock := s.current()
+	if sock == nil {
+		return 0, thrift.NewTTransportException(thrift.NOT_OPEN, "socket is not open")
+	}
+	return sock.Write(p)
+}
+
+func (s *resolverSocket) Flush(ctx context.Context) error {
+	sock := s.current()
+	if sock == nil {
+		return thrift.NewTTransportException(thrift.NOT_OPEN, "socket is not open")
+	}
+	return sock.Flush(ctx)
+}
+
+func (s *resolverSocket) RemainingBytes() uint64 {
+	sock := s.current()
+	if sock == nil {
+		return 0
+	}
+	return sock.RemainingBytes()
+}
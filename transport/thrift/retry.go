@@ -0,0 +1,107 @@
+package thrift
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// RetryPolicy retries the calls failing on a broken connection, the connection
+// is reopened before the next attempt.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts of a call, the first one included.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, it doubles on every retry
+	// up to MaxBackoff, and each wait is randomized down to its half.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// IdempotentMethods lists the methods retried once their request may have
+	// reached the server, the other methods are only retried when the request
+	// could not be sent.
+	IdempotentMethods []string
+}
+
+// retryable reports whether a call failing with err is worth another attempt.
+func (p *RetryPolicy) retryable(method string, err error) bool {
+	var te thrift.TTransportException
+	if !errors.As(err, &te) {
+		// application and protocol errors come from a server which answered
+		return false
+	}
+	if te.TypeId() == thrift.NOT_OPEN {
+		return true
+	}
+	for _, m := range p.IdempotentMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the retry following attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d > 0; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			d = p.MaxBackoff
+			break
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryClient retries the calls failing on the connection, reopening a
+// connection closed by either side before each attempt. A nil socket is
+// for HTTP, where every call makes its own request.
+func retryClient(trans thrift.TTransport, socket thrift.TTransport, policy *RetryPolicy, next thrift.TClient) thrift.TClient {
+	return thrift.WrappedTClient{
+		Wrapped: func(ctx context.Context, method string, args, result thrift.TStruct) (thrift.ResponseMeta, error) {
+			var (
+				meta thrift.ResponseMeta
+				err  error
+			)
+			for attempt := 1; ; attempt++ {
+				if socket != nil && !trans.IsOpen() {
+					err = reopen(trans)
+				}
+				if err == nil {
+					meta, err = next.Call(ctx, method, args, result)
+				}
+				if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.retryable(method, err) {
+					return meta, err
+				}
+				if socket != nil {
+					// the connection is out of sync after a failed call
+					_ = trans.Close()
+				}
+
+				timer := time.NewTimer(policy.backoff(attempt))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return meta, err
+				case <-timer.C:
+				}
+				err = nil
+			}
+		},
+	}
+}
+
+// reopen opens a closed connection again, a failure is reported as NOT_OPEN
+// since the request was not sent.
+func reopen(trans thrift.TTransport) error {
+	_ = trans.Close()
+	if err := trans.Open(); err != nil {
+		return thrift.NewTTransportException(thrift.NOT_OPEN, err.Error())
+	}
+	return nil
+}
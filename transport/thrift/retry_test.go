@@ -0,0 +1,101 @@
+package thrift
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+)
+
+func TestClient_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t)
+
+	conn, err := Dial(
+		WithEndpoint(addr),
+		WithRetry(RetryPolicy{MaxAttempts: 10, Backoff: 20 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := api.NewHygrothermographServiceClient(conn.Client)
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	// restart the server while the connection is idle
+	if err = srv.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	restarted := make(chan *Server, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		srv, _ := startHygrothermographServer(t, WithAddress(addr))
+		restarted <- srv
+	}()
+	defer func() {
+		_ = (<-restarted).Stop(ctx)
+	}()
+
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call after restart: %v", err)
+	}
+}
+
+func TestClient_RetryExhausted(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t)
+
+	conn, err := Dial(
+		WithEndpoint(addr),
+		WithRetry(RetryPolicy{
+			MaxAttempts:       3,
+			Backoff:           10 * time.Millisecond,
+			IdempotentMethods: []string{"getHygrothermograph"},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = srv.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+	if !errors.As(err, new(thrift.TTransportException)) {
+		t.Errorf("expected a transport error got %v", err)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, IdempotentMethods: []string{"get"}}
+
+	eof := thrift.NewTTransportException(thrift.END_OF_FILE, "EOF")
+	if !p.retryable("get", eof) {
+		t.Errorf("expected an idempotent method to be retried")
+	}
+	if p.retryable("set", eof) {
+		t.Errorf("expected a sent request not to be retried")
+	}
+	if !p.retryable("set", thrift.NewTTransportException(thrift.NOT_OPEN, "refused")) {
+		t.Errorf("expected a request never sent to be retried")
+	}
+	if p.retryable("get", thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "failed")) {
+		t.Errorf("expected an application exception not to be retried")
+	}
+
+	for attempt, max := range []time.Duration{100, 200, 300, 300} {
+		max *= time.Millisecond
+		if d := p.backoff(attempt + 1); d < max/2 || d > max {
+			t.Errorf("attempt %d: expected a backoff between %v and %v got %v", attempt+1, max/2, max, d)
+		}
+	}
+}
@@ -4,10 +4,18 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"net"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/blink-io/kratos-transport/transport/thrift/matcher"
+	"github.com/blink-io/kratos-transport/utils"
 	klog "github.com/go-kratos/kratos/v3/log"
+	"github.com/go-kratos/kratos/v3/middleware"
 	"github.com/go-kratos/kratos/v3/transport"
 )
 
@@ -19,10 +27,11 @@ var (
 var (
 	ErrInvalidProtocol  = errors.New("invalid protocol")
 	ErrInvalidTransport = errors.New("invalid transport")
+	ErrInvalidProcessor = errors.New("invalid processor")
+	ErrHealthDisabled   = errors.New("health service is not enabled")
 )
 
 type Server struct {
-	Server     *thrift.TSimpleServer
 	tlsConf    *tls.Config
 	address    string
 	protocol   string
@@ -31,7 +40,39 @@ type Server struct {
 	bufferSize int
 	err        error
 	processor  thrift.TProcessor
+	mux        *thrift.TMultiplexedProcessor
 	tconf      *thrift.TConfiguration
+	middleware matcher.Matcher
+	limits     matcher.Matcher
+
+	errorEncoder ErrorEncoder
+
+	unixSocketMode os.FileMode
+
+	enableKeepAlive bool
+	keepAlive       *utils.KeepAliveService
+
+	maxConns    int
+	queueSize   int
+	readTimeout time.Duration
+	idleTimeout time.Duration
+	timeout     time.Duration
+
+	handler          thrift.TProcessor
+	protocolFactory  thrift.TProtocolFactory
+	transportFactory thrift.TTransportFactory
+
+	mu     sync.Mutex
+	lis    net.Listener
+	conns  map[*serverConn]struct{}
+	queue  chan *serverConn
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	active int
+	closed bool
+
+	endpoint *url.URL
+	serveErr chan error
 }
 
 func NewServer(opts ...ServerOption) *Server {
@@ -41,8 +82,15 @@ func NewServer(opts ...ServerOption) *Server {
 		framed:     false,
 		protocol:   ProtocolBinary,
 		tconf:      &thrift.TConfiguration{},
+		middleware: matcher.New(),
+		limits:     matcher.New(),
+
+		errorEncoder: DefaultErrorEncoder,
 	}
 	srv.init(opts...)
+	if srv.enableKeepAlive {
+		srv.keepAlive = utils.NewKeepAliveService(nil)
+	}
 	return srv
 }
 
@@ -56,61 +104,268 @@ func (s *Server) init(opts ...ServerOption) {
 	}
 }
 
+// Use uses a service middleware with selector.
+// selector:
+//   - '*'
+//   - 'HygrothermographService/*'
+//   - 'HygrothermographService/getHygrothermograph'
+func (s *Server) Use(selector string, m ...middleware.Middleware) {
+	s.middleware.Add(selector, m...)
+}
+
+// RegisterProcessor hosts a multiplexed service next to the default processor, see WithMultiplexedService.
+func (s *Server) RegisterProcessor(serviceName string, processor thrift.TProcessor) {
+	if s.mux == nil {
+		s.mux = thrift.NewTMultiplexedProcessor()
+	}
+	s.mux.RegisterProcessor(serviceName, newProcessor(s, serviceName, processor))
+}
+
+// Endpoint returns the server endpoint, listening first when needed
+// so that the port bound for ":0" is reported.
 func (s *Server) Endpoint() (*url.URL, error) {
-	return url.Parse("tcp://" + s.address)
+	if err := s.listenAndEndpoint(); err != nil {
+		return nil, err
+	}
+	return s.endpoint, nil
+}
+
+// HealthEndpoint returns the endpoint of the gRPC health service enabled by
+// WithEnableKeepAlive, which reports SERVING once Start succeeded and
+// NOT_SERVING as soon as Stop begins.
+func (s *Server) HealthEndpoint() (*url.URL, error) {
+	if s.keepAlive == nil {
+		return nil, ErrHealthDisabled
+	}
+	return s.keepAlive.Endpoint()
 }
 
-func (s *Server) Start(ctx context.Context) error {
-	if s.err != nil {
-		return s.err
+func (s *Server) endpointString() string {
+	if s.endpoint == nil {
+		return ""
 	}
+	return s.endpoint.String()
+}
+
+func (s *Server) listenAndEndpoint() error {
+	if s.lis == nil {
+		lis, err := createListener(s.address, s.tlsConf, s.unixSocketMode)
+		if err != nil {
+			s.err = err
+			return err
+		}
+		s.mu.Lock()
+		s.lis = lis
+		s.mu.Unlock()
+	}
+	if s.endpoint == nil {
+		if network, path := splitAddress(s.address); network == "unix" {
+			// a relative path would render as unix:path, which is no URL to dial
+			path, err := filepath.Abs(path)
+			if err != nil {
+				s.err = err
+				return err
+			}
+			s.endpoint = &url.URL{Scheme: schemeUnix, Path: path, RawQuery: s.endpointQuery().Encode()}
+			return s.err
+		}
+		host, err := utils.ExtractHostPort(s.address, s.lis.Addr())
+		if err != nil {
+			s.err = err
+			return err
+		}
+		s.endpoint = &url.URL{Scheme: s.scheme(), Host: host, RawQuery: s.endpointQuery().Encode()}
+	}
+	return s.err
+}
+
+func (s *Server) scheme() string {
+	if s.tlsConf != nil {
+		return schemeThrifts
+	}
+	return schemeThrift
+}
+
+// endpointQuery advertises the wire settings for clients to configure themselves.
+func (s *Server) endpointQuery() url.Values {
+	query := url.Values{}
+	protocol := s.protocol
+	if protocol == "" {
+		protocol = ProtocolBinary
+	}
+	query.Set("protocol", protocol)
+	if s.framed && s.protocol != ProtocolHeader {
+		query.Set("framed", "true")
+	}
+	if s.buffered {
+		query.Set("buffered", "true")
+	}
+	return query
+}
+
+func (s *Server) Start(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			s.closeListener()
+		}
+	}()
 
 	protocolFactory := createProtocolFactory(s.protocol, s.tconf)
 	if protocolFactory == nil {
 		return ErrInvalidProtocol
 	}
 
-	transportFactory := createTransportFactory(s.tconf, s.buffered, s.framed, s.bufferSize)
+	// THeader does its own framing
+	framed := s.framed && s.protocol != ProtocolHeader
+	transportFactory := createTransportFactory(s.tconf, s.buffered, framed, s.bufferSize)
 	if transportFactory == nil {
 		return ErrInvalidTransport
 	}
 
-	serverTransport, serverTransportErr := createServerTransport(s.address, s.tlsConf)
-	if serverTransportErr != nil {
-		return serverTransportErr
+	if s.mux == nil && s.processor == nil {
+		return ErrInvalidProcessor
 	}
 
-	klog.Info("[Thrift] server listening", "addr", s.address)
+	if err = s.listenAndEndpoint(); err != nil {
+		return err
+	}
 
-	s.Server = thrift.NewTSimpleServer4(s.processor, serverTransport, transportFactory, protocolFactory)
-	go func() {
-		_ = s.Server.Serve()
-	}()
+	if s.mux != nil {
+		if s.processor != nil {
+			s.mux.RegisterDefault(newProcessor(s, "", s.processor))
+		}
+		s.handler = s.mux
+	} else {
+		s.handler = newProcessor(s, "", s.processor)
+	}
+	s.protocolFactory = protocolFactory
+	s.transportFactory = transportFactory
 
-	go func() {
-		<-ctx.Done()
-		_ = s.Server.Stop()
-	}()
+	if s.keepAlive != nil {
+		if err = s.keepAlive.Start(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.conns = make(map[*serverConn]struct{})
+	s.mu.Unlock()
+	s.serveErr = make(chan error, 1)
+	if s.maxConns > 0 {
+		s.queue = make(chan *serverConn, s.maxConns+s.queueSize)
+		s.slots = make(chan struct{}, s.maxConns+s.queueSize)
+		s.wg.Add(s.maxConns)
+		for i := 0; i < s.maxConns; i++ {
+			go s.worker()
+		}
+	}
+
+	klog.Info("[Thrift] server listening", "addr", s.lis.Addr().String())
+
+	go s.serve()
 
 	return nil
 }
 
+// closeListener closes a listener Start failed to serve.
+func (s *Server) closeListener() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lis != nil {
+		_ = s.lis.Close()
+		s.lis = nil
+	}
+}
+
+// serve accepts connections until the listener is closed, a listener failure
+// is kept for Stop to report.
+func (s *Server) serve() {
+	defer func() {
+		if s.queue != nil {
+			close(s.queue)
+		}
+	}()
+	var delay time.Duration
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				// back off on transient failures such as running out of file descriptors
+				delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+				klog.Warn("[Thrift] accept failed, retrying", "delay", delay, "error", err)
+				time.Sleep(delay)
+				continue
+			}
+			klog.Error("[Thrift] server stopped accepting connections", "error", err)
+			s.serveErr <- err
+			return
+		}
+		delay = 0
+		s.dispatch(conn)
+	}
+}
+
+// Stop stops accepting connections and closes the idle ones, then waits for
+// the in-flight calls to be answered until ctx is done, at which point the
+// remaining connections are closed.
 func (s *Server) Stop(ctx context.Context) error {
 	klog.Info("[Thrift] server stopping")
 
-	if s.Server != nil {
-		stopCh := make(chan error, 1)
-		go func() {
-			stopCh <- s.Server.Stop()
+	if s.keepAlive != nil {
+		// fail the readiness probes while the calls in progress drain
+		s.keepAlive.SetServing(false)
+		defer func() {
+			_ = s.keepAlive.Stop(ctx)
 		}()
+	}
 
+	s.mu.Lock()
+	if s.lis == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	if !s.closed {
+		s.closed = true
+		_ = s.lis.Close()
+		for c := range s.conns {
+			if c.idle {
+				_ = c.Close()
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
 		select {
-		case stopErr := <-stopCh:
-			return stopErr
-		case <-ctx.Done():
-			return ctx.Err()
+		case err := <-s.serveErr:
+			return err
+		default:
+			return nil
+		}
+	case <-ctx.Done():
+		s.mu.Lock()
+		for c := range s.conns {
+			_ = c.Close()
 		}
+		s.mu.Unlock()
+		return ctx.Err()
 	}
+}
 
-	return nil
+// activeRequests returns the number of calls being served.
+func (s *Server) activeRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
 }
@@ -2,11 +2,27 @@ package thrift
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/echo"
 	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+	kerrors "github.com/go-kratos/kratos/v3/errors"
+	"github.com/go-kratos/kratos/v3/metadata"
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type HygrothermographHandler struct {
@@ -46,3 +62,846 @@ func TestServer(t *testing.T) {
 		t.Errorf("expected nil got %v", err)
 	}
 }
+
+func TestServer_Middleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var operations []string
+	srv := NewServer(
+		WithAddress("127.0.0.1:0"),
+		WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())),
+		Middleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				tr, ok := transport.FromServerContext(ctx)
+				if !ok {
+					return nil, errors.New("no server transport")
+				}
+				operations = append(operations, tr.Operation())
+				return handler(ctx, req)
+			}
+		}),
+	)
+	var rejected bool
+	srv.Use("HygrothermographService/*", func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			if rejected {
+				return nil, kerrors.Forbidden("REJECTED", "rejected by middleware")
+			}
+			return handler(ctx, req)
+		}
+	})
+
+	if err := srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := Dial(WithEndpoint(endpoint.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewHygrothermographServiceClient(conn.Client)
+
+	reply, err := client.GetHygrothermograph(ctx)
+	if err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	if reply.Humidity == nil {
+		t.Errorf("expected humidity in reply")
+	}
+
+	rejected = true
+	_, err = client.GetHygrothermograph(ctx)
+	var exc thrift.TApplicationException
+	if !errors.As(err, &exc) || exc.TypeId() != thrift.INTERNAL_ERROR {
+		t.Errorf("expected internal error application exception, got %v", err)
+	}
+
+	// the connection must still be usable after a rejected call
+	rejected = false
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call after rejection: %v", err)
+	}
+
+	want := []string{
+		"HygrothermographService/getHygrothermograph",
+		"HygrothermographService/getHygrothermograph",
+		"HygrothermographService/getHygrothermograph",
+	}
+	if !reflect.DeepEqual(want, operations) {
+		t.Errorf("expect %v, got %v", want, operations)
+	}
+}
+
+func TestServer_HeaderProtocol(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var traceID string
+	srv := NewServer(
+		WithAddress("127.0.0.1:0"),
+		WithProtocol(ProtocolHeader),
+		WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())),
+		Middleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				if tr, ok := transport.FromServerContext(ctx); ok {
+					traceID = tr.RequestHeader().Get("x-md-global-trace")
+					tr.ReplyHeader().Set("x-reply", "pong")
+				}
+				return handler(ctx, req)
+			}
+		}),
+	)
+	if err := srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := Dial(
+		WithEndpoint(endpoint.Host),
+		WithClientProtocol(ProtocolHeader),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	callCtx := metadata.AppendToClientContext(ctx, "x-md-global-trace", "trace-1")
+	var result api.HygrothermographServiceGetHygrothermographResult
+	meta, err := conn.Client.Call(callCtx, "getHygrothermograph", &api.HygrothermographServiceGetHygrothermographArgs{}, &result)
+	if err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	if result.Success == nil {
+		t.Errorf("expected reply")
+	}
+	if traceID != "trace-1" {
+		t.Errorf("expect %v, got %v", "trace-1", traceID)
+	}
+	if v := meta.Headers["X-Reply"]; v != "pong" {
+		t.Errorf("expect %v, got %v", "pong", v)
+	}
+}
+
+func TestServer_MaxConnections(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t,
+		WithMaxConnections(1),
+		WithConnectionQueueSize(0),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	// the only worker is kept busy by the first connection
+	conn1, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = api.NewHygrothermographServiceClient(conn1.Client).GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	conn2, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn2.Client).GetHygrothermograph(ctx); err == nil {
+		t.Errorf("expected the saturated server to reject the connection")
+	}
+
+	// the worker is released once the first connection goes away
+	_ = conn1.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	conn3, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn3.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn3.Client).GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call: %v", err)
+	}
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t, WithIdleTimeout(100*time.Millisecond))
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := api.NewHygrothermographServiceClient(conn.Client)
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if _, err = client.GetHygrothermograph(ctx); err == nil {
+		t.Errorf("expected the idle connection to be closed by the server")
+	}
+}
+
+type slowHygrothermographHandler struct {
+	*HygrothermographHandler
+	delay time.Duration
+}
+
+func (p *slowHygrothermographHandler) GetHygrothermograph(ctx context.Context) (*api.Hygrothermograph, error) {
+	time.Sleep(p.delay)
+	return p.HygrothermographHandler.GetHygrothermograph(ctx)
+}
+
+func startSlowServer(t *testing.T, delay time.Duration) (*Server, string) {
+	handler := &slowHygrothermographHandler{HygrothermographHandler: NewHygrothermographHandler(), delay: delay}
+	return startHygrothermographServer(t, WithProcessor(api.NewHygrothermographServiceProcessor(handler)))
+}
+
+func TestServer_GracefulStop(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startSlowServer(t, 300*time.Millisecond)
+
+	// an idle connection must not hold the shutdown back
+	idle, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	conn, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+		errCh <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if n := srv.activeRequests(); n != 1 {
+		t.Errorf("expected 1 active request got %d", n)
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err = srv.Stop(stopCtx); err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+	if err = <-errCh; err != nil {
+		t.Errorf("expected the in-flight call to complete, got %v", err)
+	}
+	if n := srv.activeRequests(); n != 0 {
+		t.Errorf("expected 0 active request got %d", n)
+	}
+
+	// stopping again is a no-op
+	if err = srv.Stop(stopCtx); err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+}
+
+func TestServer_StopTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startSlowServer(t, time.Second)
+
+	conn, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+		errCh <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	stopCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err = srv.Stop(stopCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+	if err = <-errCh; err == nil {
+		t.Errorf("expected the call to be cut when the drain times out")
+	}
+}
+
+func TestServer_Endpoint(t *testing.T) {
+	ctx := context.Background()
+
+	srv := NewServer(
+		WithAddress("127.0.0.1:0"),
+		WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())),
+	)
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.Scheme != "thrift" || endpoint.Port() == "0" {
+		t.Errorf("expected a bound thrift endpoint got %v", endpoint)
+	}
+	if endpoint.RawQuery != "protocol=binary" {
+		t.Errorf("expected %v got %v", "protocol=binary", endpoint.RawQuery)
+	}
+
+	if err = srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(WithEndpoint(endpoint.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call: %v", err)
+	}
+}
+
+func TestServer_StartError(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	// the port is taken
+	if err := NewServer(WithAddress(addr)).Start(ctx); err == nil {
+		t.Errorf("expected listen error")
+	}
+
+	// so is the TLS setup
+	tlsConf := &tls.Config{}
+	if err := NewServer(WithAddress("127.0.0.1:0"), WithTLSConfig(tlsConf)).Start(ctx); err == nil {
+		t.Errorf("expected tls error")
+	}
+
+	// there is nothing to serve
+	if err := NewServer(WithAddress("127.0.0.1:0")).Start(ctx); !errors.Is(err, ErrInvalidProcessor) {
+		t.Errorf("expected %v got %v", ErrInvalidProcessor, err)
+	}
+}
+
+func TestServer_StartErrorReleasesListener(t *testing.T) {
+	// a failed start releases the listener opened by Endpoint
+	srv := NewServer(
+		WithAddress("127.0.0.1:0"),
+		WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())),
+		WithProtocol("bogus"),
+	)
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(context.Background()); !errors.Is(err, ErrInvalidProtocol) {
+		t.Errorf("expected %v got %v", ErrInvalidProtocol, err)
+	}
+	lis, err := net.Listen("tcp", endpoint.Host)
+	if err != nil {
+		t.Fatalf("expected the port to be released got %v", err)
+	}
+	_ = lis.Close()
+}
+
+type brokenListener struct {
+	net.Listener
+}
+
+func (l brokenListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+func TestServer_ServeError(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewServer(WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())))
+	srv.lis = brokenListener{Listener: lis}
+	if err = srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err = srv.Stop(context.Background()); err == nil || err.Error() != "accept failed" {
+		t.Errorf("expected the accept error got %v", err)
+	}
+}
+
+type echoHandler struct{}
+
+func (echoHandler) Echo(_ context.Context, req *echo.Request) (*echo.Response, error) {
+	return &echo.Response{Msg: req.Msg}, nil
+}
+
+func (echoHandler) VisitOneway(_ context.Context, _ *echo.Request) error {
+	return nil
+}
+
+func TestServer_OnewayRejected(t *testing.T) {
+	ctx := context.Background()
+
+	srv := NewServer(
+		WithAddress("127.0.0.1:0"),
+		WithProcessor(echo.NewEchoServiceProcessor(echoHandler{})),
+	)
+	srv.Use("EchoService/VisitOneway", func(middleware.Handler) middleware.Handler {
+		return func(context.Context, any) (any, error) {
+			return nil, errors.New("rejected")
+		}
+	})
+	if err := srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := thrift.NewTSocketConf(endpoint.Host, nil)
+	if err := sock.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+	proto := thrift.NewTBinaryProtocolConf(sock, nil)
+
+	// the Go client sends oneway calls as CALL, so write a ONEWAY one by hand
+	if err := proto.WriteMessageBegin(ctx, "VisitOneway", thrift.ONEWAY, 1); err != nil {
+		t.Fatal(err)
+	}
+	args := &echo.EchoServiceVisitOnewayArgs{Req: &echo.Request{Msg: "hello"}}
+	if err := args.Write(ctx, proto); err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.WriteMessageEnd(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rejected call is skipped and the next one on the connection is served
+	client := echo.NewEchoServiceClient(thrift.NewTStandardClient(proto, proto))
+	reply, err := client.Echo(ctx, &echo.Request{Msg: "hello"})
+	if err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	if reply.Msg != "hello" {
+		t.Errorf("expect %v, got %v", "hello", reply.Msg)
+	}
+}
+
+func TestServer_Multiplexed(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu         sync.Mutex
+		operations []string
+		traceIDs   []string
+	)
+	srv := NewServer(
+		WithAddress("127.0.0.1:0"),
+		WithProtocol(ProtocolHeader),
+		WithProcessor(api.NewHygrothermographServiceProcessor(NewHygrothermographHandler())),
+		Middleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				if tr, ok := transport.FromServerContext(ctx); ok {
+					mu.Lock()
+					operations = append(operations, tr.Operation())
+					traceIDs = append(traceIDs, tr.RequestHeader().Get("x-md-global-trace"))
+					mu.Unlock()
+				}
+				return handler(ctx, req)
+			}
+		}),
+	)
+	srv.RegisterProcessor("EchoService", echo.NewEchoServiceProcessor(echoHandler{}))
+	srv.RegisterProcessor("Hygrothermograph", api.NewHygrothermographServiceProcessor(NewHygrothermographHandler()))
+	if err := srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callCtx := metadata.AppendToClientContext(ctx, "x-md-global-trace", "trace-1")
+
+	echoConn, err := Dial(
+		WithEndpoint(endpoint.Host),
+		WithClientProtocol(ProtocolHeader),
+		WithMultiplexedService("EchoService"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echoConn.Close()
+	reply, err := echo.NewEchoServiceClient(echoConn.Client).Echo(callCtx, &echo.Request{Msg: "hello"})
+	if err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+	if reply.Msg != "hello" {
+		t.Errorf("expect %v, got %v", "hello", reply.Msg)
+	}
+
+	hConn, err := Dial(
+		WithEndpoint(endpoint.Host),
+		WithClientProtocol(ProtocolHeader),
+		WithMultiplexedService("Hygrothermograph"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hConn.Close()
+	if _, err = api.NewHygrothermographServiceClient(hConn.Client).GetHygrothermograph(callCtx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	// clients which are not multiplexed reach the default processor
+	conn, err := Dial(
+		WithEndpoint(endpoint.Host),
+		WithClientProtocol(ProtocolHeader),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(callCtx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"EchoService/Echo", "Hygrothermograph/getHygrothermograph", "HygrothermographService/getHygrothermograph"}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Errorf("expect %v, got %v", expected, operations)
+	}
+	for _, traceID := range traceIDs {
+		if traceID != "trace-1" {
+			t.Errorf("expect %v, got %v", "trace-1", traceID)
+		}
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	ctx := context.Background()
+
+	handler := &slowHygrothermographHandler{HygrothermographHandler: NewHygrothermographHandler(), delay: 300 * time.Millisecond}
+	srv, addr := startHygrothermographServer(t,
+		WithProcessor(api.NewHygrothermographServiceProcessor(handler)),
+		WithEnableKeepAlive(true),
+	)
+
+	endpoint, err := srv.HealthEndpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := grpc.NewClient("127.0.0.1:"+endpoint.Port(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	health := grpc_health_v1.NewHealthClient(cc)
+
+	resp, err := health.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("expected %v got %v", grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	}
+
+	conn, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		_, _ = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the status flips while the call in progress drains
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Stop(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	resp, err = health.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected %v got %v", grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.Status)
+	}
+	if err = <-stopped; err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+
+	if _, err = NewServer().HealthEndpoint(); !errors.Is(err, ErrHealthDisabled) {
+		t.Errorf("expected %v got %v", ErrHealthDisabled, err)
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.sock")
+
+	// a socket file left behind by a server which did not shut down
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	srv, _ := startHygrothermographServer(t, WithAddress("unix://"+path), WithUnixSocketMode(0o600))
+
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "unix://" + path + "?protocol=binary"; endpoint.String() != want {
+		t.Errorf("expected %v got %v", want, endpoint.String())
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("expected %v got %v", os.FileMode(0o600), fi.Mode().Perm())
+	}
+
+	conn, err := Dial(WithEndpoint(endpoint.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	if err = srv.Stop(ctx); err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+	if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the socket file to be removed got %v", err)
+	}
+}
+
+func TestServer_UnixSocketRelativePath(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	srv, _ := startHygrothermographServer(t, WithAddress("unix://app.sock"))
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	// the endpoint holds the absolute path, a relative one is no URL to dial
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(dir, "app.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := filepath.EvalSymlinks(endpoint.Path); endpoint.Scheme != schemeUnix || got != path {
+		t.Errorf("expected unix://%v got %v", path, endpoint.String())
+	}
+
+	conn, err := Dial(WithEndpoint(endpoint.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	// and so does a discovered one
+	d := newMockDiscovery()
+	d.publish(endpoint.String())
+	cli, err := NewClient(WithEndpoint("discovery:///hygrothermograph"), WithDiscovery(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if _, err = api.NewHygrothermographServiceClient(cli).GetHygrothermograph(ctx); err != nil {
+		t.Fatalf("failed to call a discovered node: %v", err)
+	}
+}
+
+type funcHygrothermographHandler func(ctx context.Context) (*api.Hygrothermograph, error)
+
+func (f funcHygrothermographHandler) GetHygrothermograph(ctx context.Context) (*api.Hygrothermograph, error) {
+	return f(ctx)
+}
+
+func TestServer_PanicRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	var calls int
+	handler := funcHygrothermographHandler(func(ctx context.Context) (*api.Hygrothermograph, error) {
+		calls++
+		if calls == 1 {
+			panic("sensor unplugged")
+		}
+		return NewHygrothermographHandler().GetHygrothermograph(ctx)
+	})
+	srv, addr := startHygrothermographServer(t,
+		WithProtocol(ProtocolHeader),
+		WithProcessor(api.NewHygrothermographServiceProcessor(handler)),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(WithEndpoint(addr), WithClientProtocol(ProtocolHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := api.NewHygrothermographServiceClient(conn.Client)
+	_, err = client.GetHygrothermograph(ctx)
+	if se := kerrors.FromError(err); se.Code != 500 || se.Reason != "THRIFT_PANIC" {
+		t.Errorf("expected a panic error got %v", err)
+	}
+	var tae thrift.TApplicationException
+	if !errors.As(err, &tae) || tae.TypeId() != thrift.INTERNAL_ERROR {
+		t.Errorf("expected an internal error exception got %v", err)
+	}
+
+	// the connection survives the panic
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call after the panic: %v", err)
+	}
+}
+
+func TestServer_ShortCircuit(t *testing.T) {
+	ctx := context.Background()
+
+	srv, addr := startHygrothermographServer(t,
+		WithProtocol(ProtocolHeader),
+		Middleware(func(handler middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, req any) (any, error) {
+				switch tr, _ := transport.FromServerContext(ctx); tr.RequestHeader().Get("x-md-global-mode") {
+				case "skip":
+					// answers without calling the processor nor failing
+					return nil, nil
+				case "panic":
+					panic("middleware failed")
+				}
+				return handler(ctx, req)
+			}
+		}),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(WithEndpoint(addr), WithClientProtocol(ProtocolHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewHygrothermographServiceClient(conn.Client)
+
+	_, err = client.GetHygrothermograph(metadata.AppendToClientContext(ctx, "x-md-global-mode", "skip"))
+	var tae thrift.TApplicationException
+	if !errors.As(err, &tae) || tae.TypeId() != thrift.MISSING_RESULT {
+		t.Errorf("expected a missing result exception got %v", err)
+	}
+
+	_, err = client.GetHygrothermograph(metadata.AppendToClientContext(ctx, "x-md-global-mode", "panic"))
+	if se := kerrors.FromError(err); se.Code != 500 || se.Reason != "THRIFT_PANIC" {
+		t.Errorf("expected a panic error got %v", err)
+	}
+
+	// the server and the connection survive both
+	if _, err = client.GetHygrothermograph(ctx); err != nil {
+		t.Errorf("failed to call: %v", err)
+	}
+}
+
+func TestServer_Timeout(t *testing.T) {
+	ctx := context.Background()
+
+	handler := funcHygrothermographHandler(func(ctx context.Context) (*api.Hygrothermograph, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+			return NewHygrothermographHandler().GetHygrothermograph(ctx)
+		}
+	})
+	srv, addr := startHygrothermographServer(t,
+		WithProcessor(api.NewHygrothermographServiceProcessor(handler)),
+		Timeout(100*time.Millisecond),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(WithEndpoint(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	_, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(ctx)
+	var tae thrift.TApplicationException
+	if !errors.As(err, &tae) || tae.TypeId() != thrift.INTERNAL_ERROR {
+		t.Errorf("expected an internal error exception got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the handler to be canceled, took %v", elapsed)
+	}
+}
@@ -0,0 +1,161 @@
+package thrift
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// aLongTimeAgo is a deadline which makes blocked reads and writes fail at once.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// callDeadliner is a client socket which bounds its reads and writes by the
+// deadline of the call in progress, a zero deadline lifts the bound.
+type callDeadliner interface {
+	setCallDeadline(t time.Time)
+}
+
+// deadlineConn clamps the deadlines thrift sets before every read and write
+// to the deadline of the call in progress.
+type deadlineConn struct {
+	net.Conn
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *deadlineConn) clamp(t time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.deadline.IsZero() || (!t.IsZero() && t.Before(c.deadline)) {
+		return t
+	}
+	return c.deadline
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(c.clamp(t))
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(c.clamp(t))
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	return c.Conn.SetWriteDeadline(c.clamp(t))
+}
+
+func (c *deadlineConn) setCallDeadline(t time.Time) {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	_ = c.Conn.SetDeadline(t)
+}
+
+// syscallDeadlineConn keeps the connectivity check of TSocket.IsOpen working
+// for connections which expose their file descriptor.
+type syscallDeadlineConn struct {
+	*deadlineConn
+}
+
+func (c syscallDeadlineConn) SyscallConn() (syscall.RawConn, error) {
+	return c.Conn.(syscall.Conn).SyscallConn()
+}
+
+var (
+	_ thrift.TTransport = (*clientSocket)(nil)
+	_ callDeadliner     = (*clientSocket)(nil)
+)
+
+// clientSocket is a TSocket over TCP or a Unix socket, or a TLS one when cfg
+// carries a TLS config, which dials on Open so that its connection deadlines can be clamped.
+type clientSocket struct {
+	network string
+	addr    string
+	cfg     *thrift.TConfiguration
+
+	conn *deadlineConn
+	sock *thrift.TSocket
+}
+
+func newClientSocket(network, addr string, cfg *thrift.TConfiguration) *clientSocket {
+	return &clientSocket{network: network, addr: addr, cfg: cfg}
+}
+
+func (s *clientSocket) Open() error {
+	if s.sock != nil && s.sock.IsOpen() {
+		return thrift.NewTTransportException(thrift.ALREADY_OPEN, "Socket already connected.")
+	}
+
+	dialer := &net.Dialer{Timeout: s.cfg.GetConnectTimeout()}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if tlsConf := s.cfg.GetTLSConfig(); tlsConf != nil {
+		conn, err = tls.DialWithDialer(dialer, s.network, s.addr, tlsConf)
+	} else {
+		conn, err = dialer.DialContext(context.Background(), s.network, s.addr)
+	}
+	if err != nil {
+		return thrift.NewTTransportException(thrift.NOT_OPEN, err.Error())
+	}
+
+	s.conn = &deadlineConn{Conn: conn}
+	var nc net.Conn = s.conn
+	if _, ok := conn.(syscall.Conn); ok {
+		nc = syscallDeadlineConn{deadlineConn: s.conn}
+	}
+	s.sock = thrift.NewTSocketFromConnConf(nc, s.cfg)
+	return nil
+}
+
+func (s *clientSocket) setCallDeadline(t time.Time) {
+	if s.conn != nil {
+		s.conn.setCallDeadline(t)
+	}
+}
+
+func (s *clientSocket) IsOpen() bool {
+	return s.sock != nil && s.sock.IsOpen()
+}
+
+func (s *clientSocket) Close() error {
+	if s.sock == nil {
+		return nil
+	}
+	return s.sock.Close()
+}
+
+func (s *clientSocket) Read(p []byte) (int, error) {
+	if s.sock == nil {
+		return 0, thrift.NewTTransportException(thrift.NOT_OPEN, "socket is not open")
+	}
+	return s.sock.Read(p)
+}
+
+func (s *clientSocket) Write(p []byte) (int, error) {
+	if s.sock == nil {
+		return 0, thrift.NewTTransportException(thrift.NOT_OPEN, "socket is not open")
+	}
+	return s.sock.Write(p)
+}
+
+func (s *clientSocket) Flush(ctx context.Context) error {
+	if s.sock == nil {
+		return thrift.NewTTransportException(thrift.NOT_OPEN, "socket is not open")
+	}
+	return s.sock.Flush(ctx)
+}
+
+func (s *clientSocket) RemainingBytes() uint64 {
+	if s.sock == nil {
+		return 0
+	}
+	return s.sock.RemainingBytes()
+}
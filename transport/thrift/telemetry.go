@@ -0,0 +1,146 @@
+package thrift
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v3/middleware"
+	"github.com/go-kratos/kratos/v3/transport"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/blink-io/kratos-transport/transport/thrift"
+
+// The values of the result attribute of the server metrics.
+const (
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+type telemetryOptions struct {
+	meterProvider  metric.MeterProvider
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+// TelemetryOption is a Telemetry option.
+type TelemetryOption func(o *telemetryOptions)
+
+// WithMeterProvider with the meter provider recording the server metrics,
+// the global one by default.
+func WithMeterProvider(mp metric.MeterProvider) TelemetryOption {
+	return func(o *telemetryOptions) {
+		o.meterProvider = mp
+	}
+}
+
+// WithTracerProvider with the tracer provider starting the server spans,
+// the global one by default.
+func WithTracerProvider(tp trace.TracerProvider) TelemetryOption {
+	return func(o *telemetryOptions) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithPropagator with the propagator extracting the caller span from the
+// request header, the global one by default.
+func WithPropagator(p propagation.TextMapPropagator) TelemetryOption {
+	return func(o *telemetryOptions) {
+		o.propagator = p
+	}
+}
+
+// Telemetry is a server middleware recording the count, the latency and the
+// in-flight number of calls labeled by service, method and result, and running
+// each call in a server span continuing the span of the caller found in the
+// THeader or HTTP request header. Put it first so that it sees every call.
+func Telemetry(opts ...TelemetryOption) middleware.Middleware {
+	o := &telemetryOptions{
+		meterProvider:  otel.GetMeterProvider(),
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	meter := o.meterProvider.Meter(instrumentationName)
+	requests, err := meter.Int64Counter("rpc.server.requests",
+		metric.WithDescription("The number of thrift calls served."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	duration, err := meter.Float64Histogram("rpc.server.duration",
+		metric.WithDescription("The duration of thrift calls."),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	active, err := meter.Int64UpDownCounter("rpc.server.active_requests",
+		metric.WithDescription("The number of thrift calls in flight."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	tracer := o.tracerProvider.Tracer(instrumentationName)
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			service, method := splitOperation(tr.Operation())
+			attrs := []attribute.KeyValue{
+				attribute.String("rpc.system", "thrift"),
+				attribute.String("rpc.service", service),
+				attribute.String("rpc.method", method),
+			}
+
+			ctx = o.propagator.Extract(ctx, tr.RequestHeader())
+			ctx, span := tracer.Start(ctx, tr.Operation(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attrs...))
+			defer span.End()
+
+			inflight := metric.WithAttributes(attrs...)
+			if active != nil {
+				active.Add(ctx, 1, inflight)
+				defer active.Add(ctx, -1, inflight)
+			}
+
+			start := time.Now()
+			reply, err := handler(ctx, req)
+
+			result := resultOK
+			if err != nil {
+				result = resultError
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			labels := metric.WithAttributes(append(attrs, attribute.String("result", result))...)
+			if requests != nil {
+				requests.Add(ctx, 1, labels)
+			}
+			if duration != nil {
+				duration.Record(ctx, time.Since(start).Seconds(), labels)
+			}
+			return reply, err
+		}
+	}
+}
+
+// splitOperation splits a Service/method operation.
+func splitOperation(operation string) (service, method string) {
+	if i := strings.LastIndexByte(operation, '/'); i >= 0 {
+		return operation[:i], operation[i+1:]
+	}
+	return "", operation
+}
@@ -0,0 +1,100 @@
+package thrift
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/blink-io/kratos-transport/testing/api/thrift/gen-go/hygrothermograph"
+	"github.com/go-kratos/kratos/v3/transport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestServer_Telemetry(t *testing.T) {
+	ctx := context.Background()
+
+	reader := sdkmetric.NewManualReader()
+	exporter := tracetest.NewInMemoryExporter()
+	srv, addr := startHygrothermographServer(t,
+		WithProtocol(ProtocolHeader),
+		Middleware(Telemetry(
+			WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+			WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))),
+			WithPropagator(propagation.TraceContext{}),
+		)),
+	)
+	defer func() {
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := Dial(
+		WithEndpoint(addr),
+		WithClientProtocol(ProtocolHeader),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tr := &Transport{reqHeader: headerCarrier{}, replyHeader: headerCarrier{}}
+	tr.reqHeader.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	if _, err = api.NewHygrothermographServiceClient(conn.Client).GetHygrothermograph(transport.NewClientContext(ctx, tr)); err != nil {
+		t.Fatalf("failed to call: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "HygrothermographService/getHygrothermograph" {
+		t.Errorf("expected %v got %v", "HygrothermographService/getHygrothermograph", span.Name)
+	}
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("expected %v got %v", trace.SpanKindServer, span.SpanKind)
+	}
+	if got := span.Parent.TraceID().String(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected the caller trace got %v", got)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err = reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	requests, ok := metrics["rpc.server.requests"].(metricdata.Sum[int64])
+	if !ok || len(requests.DataPoints) != 1 {
+		t.Fatalf("expected a request count got %v", metrics["rpc.server.requests"])
+	}
+	dp := requests.DataPoints[0]
+	if dp.Value != 1 {
+		t.Errorf("expected %v got %v", 1, dp.Value)
+	}
+	for k, v := range map[attribute.Key]string{
+		"rpc.service": "HygrothermographService",
+		"rpc.method":  "getHygrothermograph",
+		"result":      resultOK,
+	} {
+		if got, _ := dp.Attributes.Value(k); got.AsString() != v {
+			t.Errorf("expected %v=%v got %v", k, v, got.AsString())
+		}
+	}
+
+	if duration, ok := metrics["rpc.server.duration"].(metricdata.Histogram[float64]); !ok || duration.DataPoints[0].Count != 1 {
+		t.Errorf("expected a latency sample got %v", metrics["rpc.server.duration"])
+	}
+	if active, ok := metrics["rpc.server.active_requests"].(metricdata.Sum[int64]); !ok || active.DataPoints[0].Value != 0 {
+		t.Errorf("expected no call in flight got %v", metrics["rpc.server.active_requests"])
+	}
+}
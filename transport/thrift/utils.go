@@ -2,6 +2,12 @@ package thrift
 
 import (
 	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strings"
 
 	"github.com/apache/thrift/lib/go/thrift"
 )
@@ -12,6 +18,7 @@ const (
 	ProtocolSimpleJSON = "simplejson"
 	ProtocolJSON       = "json"
 	ProtocolDebug      = "debug"
+	ProtocolHeader     = "header"
 )
 
 func createProtocolFactory(protocol string, conf *thrift.TConfiguration) thrift.TProtocolFactory {
@@ -22,6 +29,8 @@ func createProtocolFactory(protocol string, conf *thrift.TConfiguration) thrift.
 		return thrift.NewTSimpleJSONProtocolFactoryConf(conf)
 	case ProtocolJSON:
 		return thrift.NewTJSONProtocolFactory()
+	case ProtocolHeader:
+		return thrift.NewTHeaderProtocolFactoryConf(conf)
 	case ProtocolBinary, "":
 		return thrift.NewTBinaryProtocolFactoryConf(conf)
 	default:
@@ -45,22 +54,78 @@ func createTransportFactory(cfg *thrift.TConfiguration, buffered, framed bool, b
 	return transportFactory
 }
 
-func createServerTransport(address string, tlsConf *tls.Config) (thrift.TServerTransport, error) {
+// splitAddress returns the network and the address to listen on or dial,
+// a unix:// address names a Unix domain socket.
+func splitAddress(address string) (network, addr string) {
+	if !strings.HasPrefix(address, schemeUnix+"://") {
+		return "tcp", address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "unix", strings.TrimPrefix(address, schemeUnix+"://")
+	}
+	return "unix", u.Host + u.Path
+}
+
+// createListener listens on a TCP address or a Unix socket, whose file is
+// given mode when not zero.
+func createListener(address string, tlsConf *tls.Config, mode os.FileMode) (net.Listener, error) {
+	if tlsConf != nil && len(tlsConf.Certificates) == 0 && tlsConf.GetCertificate == nil && tlsConf.GetConfigForClient == nil {
+		// the check tls.Listen does before listening
+		return nil, errors.New("tls: neither Certificates, GetCertificate, nor GetConfigForClient set in Config")
+	}
+
+	network, addr := splitAddress(address)
+	if network == "unix" {
+		if err := removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	lis, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" && mode != 0 {
+		if err = os.Chmod(addr, mode); err != nil {
+			_ = lis.Close()
+			return nil, err
+		}
+	}
 	if tlsConf != nil {
-		return thrift.NewTSSLServerSocket(address, tlsConf)
-	} else {
-		return thrift.NewTServerSocket(address)
+		return tls.NewListener(lis, tlsConf), nil
 	}
+	return lis, nil
 }
 
-func createClientTransport(transportFactory thrift.TTransportFactory, address string, secure bool, cfg *thrift.TConfiguration) (thrift.TTransport, error) {
-	var transport thrift.TTransport
-	if secure {
-		transport = thrift.NewTSSLSocketConf(address, cfg)
-	} else {
-		transport = thrift.NewTSocketConf(address, cfg)
+// removeStaleSocket removes the socket file left behind by a server which
+// did not shut down, a socket still accepting connections is kept.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return nil
 	}
-	transport, err := transportFactory.GetTransport(transport)
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// createClientSocket opens a TLS socket when cfg carries a TLS config.
+func createClientSocket(address string, cfg *thrift.TConfiguration) thrift.TTransport {
+	network, addr := splitAddress(address)
+	return newClientSocket(network, addr, cfg)
+}
+
+func createClientTransport(transportFactory thrift.TTransportFactory, socket thrift.TTransport) (thrift.TTransport, error) {
+	transport, err := transportFactory.GetTransport(socket)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// AddrPort returns the port of a TCP or UDP address.
+func AddrPort(addr net.Addr) (int, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.Port, true
+	case *net.UDPAddr:
+		return a.Port, true
+	}
+	return 0, false
+}
+
+// ExtractHostPort returns a dialable host:port for a server listening on hostPort.
+// The port is taken from the bound addr when it is not nil, so ":0" resolves to the
+// real port, and an empty or unspecified host is replaced by a routable interface IP.
+func ExtractHostPort(hostPort string, addr net.Addr) (string, error) {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil && addr == nil {
+		return "", err
+	}
+	if addr != nil {
+		p, ok := AddrPort(addr)
+		if !ok {
+			return "", fmt.Errorf("failed to extract port: %v", addr)
+		}
+		port = strconv.Itoa(p)
+	}
+	if len(host) > 0 && host != "0.0.0.0" && host != "[::]" && host != "::" {
+		return net.JoinHostPort(host, port), nil
+	}
+
+	ip, err := routableIP()
+	if err != nil {
+		return "", err
+	}
+	if ip == nil {
+		return "", fmt.Errorf("no routable IP address found")
+	}
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// routableIP returns a global unicast IP of the lowest indexed interface that is up,
+// preferring IPv4.
+func routableIP() (net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		minIndex = 0
+		ips      = make([]net.IP, 0, 1)
+	)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if iface.Index >= minIndex && len(ips) != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, rawAddr := range addrs {
+			var ip net.IP
+			switch a := rawAddr.(type) {
+			case *net.IPAddr:
+				ip = a.IP
+			case *net.IPNet:
+				ip = a.IP
+			default:
+				continue
+			}
+			if ip.IsGlobalUnicast() && !ip.IsInterfaceLocalMulticast() {
+				minIndex = iface.Index
+				ips = append(ips, ip)
+				if ip.To4() != nil {
+					break
+				}
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, nil
+	}
+	return ips[len(ips)-1], nil
+}
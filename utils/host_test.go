@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractHostPort(t *testing.T) {
+	addr, err := ExtractHostPort("127.0.0.1:8000", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:8000", addr)
+
+	addr, err = ExtractHostPort("127.0.0.1:0", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345})
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:12345", addr)
+
+	addr, err = ExtractHostPort(":0", &net.TCPAddr{Port: 23456})
+	if err == nil {
+		host, port, err := net.SplitHostPort(addr)
+		assert.Nil(t, err)
+		assert.Equal(t, "23456", port)
+		assert.True(t, net.ParseIP(host).IsGlobalUnicast())
+	}
+
+	_, err = ExtractHostPort("bad-address", nil)
+	assert.NotNil(t, err)
+
+	_, err = ExtractHostPort(":0", &net.UnixAddr{Name: "/tmp/sock", Net: "unix"})
+	assert.NotNil(t, err)
+}
@@ -83,6 +83,16 @@ func (s *KeepAliveService) Stop(ctx context.Context) error {
 	}
 }
 
+// SetServing flips the health status between SERVING and NOT_SERVING,
+// so that probes fail while the owning server drains.
+func (s *KeepAliveService) SetServing(serving bool) {
+	if serving {
+		s.health.Resume()
+	} else {
+		s.health.Shutdown()
+	}
+}
+
 func (s *KeepAliveService) generatePort(min, max int) int {
 	return rand.Intn(max-min) + min
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestKeepAliveService(t *testing.T) {
@@ -66,3 +67,18 @@ func TestKeepAliveServicePortRange(t *testing.T) {
 	svc.lis = nil
 	svc.endpoint = nil
 }
+
+func TestKeepAliveServiceSetServing(t *testing.T) {
+	svc := NewKeepAliveService(nil)
+	req := &grpc_health_v1.HealthCheckRequest{}
+
+	svc.SetServing(false)
+	resp, err := svc.health.Check(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.Status)
+
+	svc.SetServing(true)
+	resp, err = svc.health.Check(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+}